@@ -0,0 +1,375 @@
+package gofs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type basePathFilesystem struct {
+	fs   FileSystem
+	base string
+
+	// mu guards cwd, which is a path in the confined namespace.
+	mu  sync.RWMutex
+	cwd string
+}
+
+// BasePath creates a FileSystem that confines fs to the directory base, which
+// appears as "/". Paths are resolved within that namespace, symlinks included,
+// and like openat2 with RESOLVE_BENEATH, any path that would lead out of it
+// fails with syscall.EXDEV. That goes for ".." above the root, and for symlinks
+// leading elsewhere in fs. Errors report the paths callers passed in, never
+// where they are in fs.
+//
+// Absolute symlink targets are stored as paths in fs, so that they work from
+// outside too, and Readlink turns them back. The confinement is only as good
+// as fs is still: something else swapping a directory beneath base for a
+// symlink while a path is in use can lead out of it.
+func BasePath(fs FileSystem, base string) FileSystem {
+	if abs, err := fs.Abs(base); err == nil {
+		base = abs
+	}
+	return &basePathFilesystem{
+		fs:   fs,
+		base: filepath.Clean(base),
+		cwd:  "/",
+	}
+}
+
+// real converts a path in the confined namespace into a path in fs.
+func (fs *basePathFilesystem) real(path string) string {
+	return filepath.Join(fs.base, path)
+}
+
+// virtual converts a path in fs into one in the confined namespace, or returns
+// EXDEV if it's outside base.
+func (fs *basePathFilesystem) virtual(path string) (string, error) {
+	path = filepath.Clean(path)
+	switch {
+	case fs.base == "/":
+		return path, nil
+	case path == fs.base:
+		return "/", nil
+	case strings.HasPrefix(path, fs.base+"/"):
+		return path[len(fs.base):], nil
+	}
+	return "", syscall.EXDEV
+}
+
+// beneath resolves path lexically against dir, both in the confined namespace,
+// returning EXDEV if it climbs above the root.
+func beneath(dir string, path string) (string, error) {
+	if strings.HasPrefix(path, "/") {
+		dir = "/"
+	}
+	for _, name := range splitPath(path) {
+		if name == ".." && dir == "/" {
+			return "", syscall.EXDEV
+		}
+		dir = filepath.Join(dir, name)
+	}
+	return dir, nil
+}
+
+// readlink reads the symlink at path, in the confined namespace, returning
+// EXDEV if it leads out of it.
+func (fs *basePathFilesystem) readlink(path string) (string, error) {
+	target, err := fs.fs.Readlink(fs.real(path))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(target, "/") {
+		return fs.virtual(target)
+	}
+	if _, err := beneath(filepath.Dir(path), target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// resolve turns name into an absolute path in the confined namespace with no
+// symlinks in it.
+func (fs *basePathFilesystem) resolve(name string, follow bool) (string, error) {
+	fs.mu.RLock()
+	cwd := fs.cwd
+	fs.mu.RUnlock()
+
+	r := resolver{
+		lstat: func(path string) (os.FileInfo, error) {
+			return fs.fs.Lstat(fs.real(path))
+		},
+		readlink: fs.readlink,
+		beneath:  true,
+	}
+	return r.resolve(cwd, name, follow)
+}
+
+// path resolves name to a path in fs, keeping any trailing slash so that fs
+// still insists on a directory.
+func (fs *basePathFilesystem) path(name string, follow bool) (string, error) {
+	path, err := fs.resolve(name, follow)
+	if err != nil {
+		return "", err
+	}
+	real := fs.real(path)
+	if strings.HasSuffix(name, "/") && !strings.HasSuffix(real, "/") {
+		real += "/"
+	}
+	return real, nil
+}
+
+// removable resolves name for removing or renaming it, which isn't allowed for
+// the root, or for a path ending in "." or "..".
+func (fs *basePathFilesystem) removable(name string) (string, error) {
+	path, err := fs.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+	switch base := filepath.Base(name); {
+	case base == "." || base == "..":
+		return "", syscall.EINVAL
+	case path == "/":
+		return "", syscall.EBUSY
+	}
+	return fs.real(path), nil
+}
+
+// stat is Stat and Lstat.
+func (fs *basePathFilesystem) stat(op string, name string, follow bool) (os.FileInfo, error) {
+	path, err := fs.path(name, follow)
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+	var info os.FileInfo
+	if follow {
+		info, err = fs.fs.Stat(path)
+	} else {
+		info, err = fs.fs.Lstat(path)
+	}
+	if err != nil {
+		return nil, pathErr(op, name, err)
+	}
+	if base := filepath.Base(name); info.Name() != base {
+		// The root is named after base, and symlinks after their targets.
+		info = &renamedInfo{info, base}
+	}
+	return info, nil
+}
+
+func (fs *basePathFilesystem) Stat(name string) (os.FileInfo, error) {
+	return fs.stat("stat", name, true)
+}
+
+func (fs *basePathFilesystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.stat("lstat", name, false)
+}
+
+func (fs *basePathFilesystem) Getwd() (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.cwd, nil
+}
+
+func (fs *basePathFilesystem) Chdir(dir string) error {
+	path, err := fs.resolve(dir, true)
+	if err != nil {
+		return opError("chdir", dir, err)
+	}
+	info, err := fs.fs.Stat(fs.real(path))
+	if err != nil {
+		return opError("chdir", dir, err)
+	}
+	if !info.IsDir() {
+		return &os.PathError{
+			Op:   "chdir",
+			Err:  syscall.ENOTDIR,
+			Path: dir,
+		}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.cwd = path
+	return nil
+}
+
+func (fs *basePathFilesystem) Abs(path string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	abs, err := beneath(fs.cwd, path)
+	if err != nil {
+		return "", &os.PathError{
+			Op:   "abs",
+			Err:  err,
+			Path: path,
+		}
+	}
+	return abs, nil
+}
+
+// apply resolves name and calls f with its path in fs.
+func (fs *basePathFilesystem) apply(op string, name string, follow bool, f func(path string) error) error {
+	path, err := fs.path(name, follow)
+	if err != nil {
+		return opError(op, name, err)
+	}
+	if err := f(path); err != nil {
+		return pathErr(op, name, err)
+	}
+	return nil
+}
+
+func (fs *basePathFilesystem) Chmod(name string, mode os.FileMode) error {
+	return fs.apply("chmod", name, true, func(path string) error {
+		return fs.fs.Chmod(path, mode)
+	})
+}
+
+func (fs *basePathFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.apply("chtimes", name, true, func(path string) error {
+		return fs.fs.Chtimes(path, atime, mtime)
+	})
+}
+
+func (fs *basePathFilesystem) Chown(name string, uid, gid int) error {
+	return fs.apply("chown", name, true, func(path string) error {
+		return fs.fs.Chown(path, uid, gid)
+	})
+}
+
+func (fs *basePathFilesystem) Lchown(name string, uid, gid int) error {
+	return fs.apply("lchown", name, false, func(path string) error {
+		return fs.fs.Lchown(path, uid, gid)
+	})
+}
+
+func (fs *basePathFilesystem) Truncate(name string, size int64) error {
+	return fs.apply("truncate", name, true, func(path string) error {
+		return fs.fs.Truncate(path, size)
+	})
+}
+
+func (fs *basePathFilesystem) Mkdir(name string, perm os.FileMode) error {
+	return fs.apply("mkdir", name, false, func(path string) error {
+		return fs.fs.Mkdir(path, perm)
+	})
+}
+
+func (fs *basePathFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	return mkdirAll(fs, path, perm)
+}
+
+func (fs *basePathFilesystem) Readlink(name string) (string, error) {
+	path, err := fs.resolve(name, false)
+	if err != nil {
+		return "", opError("readlink", name, err)
+	}
+	target, err := fs.readlink(path)
+	if err != nil {
+		return "", pathErr("readlink", name, err)
+	}
+	return target, nil
+}
+
+func (fs *basePathFilesystem) Symlink(oldname, newname string) error {
+	path, err := fs.resolve(newname, false)
+	if err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	abs, err := beneath(filepath.Dir(path), oldname)
+	if err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	target := oldname
+	if strings.HasPrefix(oldname, "/") {
+		target = fs.real(abs)
+	}
+	if err := fs.fs.Symlink(target, fs.real(path)); err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	return nil
+}
+
+func (fs *basePathFilesystem) Link(oldname, newname string) error {
+	oldpath, err := fs.path(oldname, false)
+	if err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	newpath, err := fs.path(newname, false)
+	if err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	if err := fs.fs.Link(oldpath, newpath); err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	return nil
+}
+
+func (fs *basePathFilesystem) Open(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *basePathFilesystem) Create(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(0666))
+}
+
+func (fs *basePathFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	exclusive := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+	path, err := fs.path(name, !exclusive && flag&oNoFollow == 0)
+	if err != nil {
+		return nil, opError("open", name, err)
+	}
+	file, err := fs.fs.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, pathErr("open", name, err)
+	}
+	return &renamedFile{
+		File: file,
+		name: name,
+	}, nil
+}
+
+func (fs *basePathFilesystem) Remove(name string) error {
+	path, err := fs.removable(name)
+	if err != nil {
+		return opError("remove", name, err)
+	}
+	if err := fs.fs.Remove(path); err != nil {
+		return pathErr("remove", name, err)
+	}
+	return nil
+}
+
+func (fs *basePathFilesystem) RemoveAll(name string) error {
+	path, err := fs.removable(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return opError("RemoveAll", name, err)
+	}
+	if err := fs.fs.RemoveAll(path); err != nil {
+		return pathErr("RemoveAll", name, err)
+	}
+	return nil
+}
+
+func (fs *basePathFilesystem) Rename(oldpath, newpath string) error {
+	src, err := fs.removable(oldpath)
+	if err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	dst, err := fs.removable(newpath)
+	if err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	if err := fs.fs.Rename(src, dst); err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package gofs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func testEscape(t *testing.T, name string, err error) {
+	t.Run(name, func(t *testing.T) {
+		if !errors.Is(err, syscall.EXDEV) {
+			t.Fatalf("Expected EXDEV, got '%v'", err)
+		}
+		if strings.Contains(err.Error(), "/sandbox") {
+			t.Fatalf("Error gives away the base path: '%v'", err)
+		}
+	})
+}
+
+func TestBasePath(t *testing.T) {
+	mfs := MockFs()
+	mfs.MkdirAll("/sandbox/dir", os.FileMode(0755))
+	WriteFile(mfs, "/sandbox/dir/file", []byte("inside"), os.FileMode(0644))
+	WriteFile(mfs, "/secret", []byte("outside"), os.FileMode(0644))
+	mfs.Symlink("/secret", "/sandbox/abs")
+	mfs.Symlink("../secret", "/sandbox/rel")
+	mfs.Symlink("/sandbox/dir/file", "/sandbox/inside")
+
+	fs := BasePath(mfs, "/sandbox")
+
+	testReadFile(t, fs, "/dir/file", "inside")
+	testReadFile(t, fs, "/inside", "inside")
+	testReadFile(t, fs, "/dir/../dir/file", "inside")
+
+	t.Run("Escapes", func(t *testing.T) {
+		_, err := fs.Open("/../secret")
+		testEscape(t, "DotDot", err)
+		_, err = fs.Open("/abs")
+		testEscape(t, "AbsoluteLink", err)
+		_, err = fs.Open("/rel")
+		testEscape(t, "RelativeLink", err)
+		_, err = fs.Readlink("/abs")
+		testEscape(t, "Readlink", err)
+		testEscape(t, "Symlink", fs.Symlink("../../secret", "/dir/link"))
+		_, err = fs.Abs("..")
+		testEscape(t, "Abs", err)
+	})
+
+	t.Run("Symlink", func(t *testing.T) {
+		if err := fs.Symlink("/dir/file", "/dir/link"); err != nil {
+			t.Fatalf("Unexpected error from Symlink: %v", err)
+		}
+		target, err := fs.Readlink("/dir/link")
+		if err != nil {
+			t.Fatalf("Unexpected error from Readlink: %v", err)
+		}
+		if target != "/dir/file" {
+			t.Fatalf("Unexpected target: '%v'", target)
+		}
+		// The link works from outside too.
+		testReadFile(t, mfs, "/sandbox/dir/link", "inside")
+	})
+
+	t.Run("Chdir", func(t *testing.T) {
+		if err := fs.Chdir("/dir"); err != nil {
+			t.Fatalf("Unexpected error from Chdir: %v", err)
+		}
+		defer fs.Chdir("/")
+
+		wd, err := fs.Getwd()
+		if err != nil {
+			t.Fatalf("Unexpected error from Getwd: %v", err)
+		}
+		if wd != "/dir" {
+			t.Fatalf("Unexpected working directory: '%v'", wd)
+		}
+		testReadFile(t, fs, "file", "inside")
+		_, err = fs.Open("../../secret")
+		testEscape(t, "Relative", err)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := fs.Open("/dir/missing")
+		var pe *os.PathError
+		if !errors.As(err, &pe) || pe.Path != "/dir/missing" || !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Unexpected error from Open: %v", err)
+		}
+
+		f, err := fs.Open("/dir")
+		if err != nil {
+			t.Fatalf("Unexpected error from Open: %v", err)
+		}
+		defer f.Close()
+		if f.Name() != "/dir" {
+			t.Fatalf("Unexpected name: '%v'", f.Name())
+		}
+		_, err = f.Read(make([]byte, 1))
+		if !errors.As(err, &pe) || pe.Path != "/dir" {
+			t.Fatalf("Unexpected error from Read: %v", err)
+		}
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		info, err := fs.Stat("/")
+		if err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		if info.Name() != "/" {
+			t.Fatalf("Unexpected name: '%v'", info.Name())
+		}
+		if err := fs.RemoveAll("/"); !errors.Is(err, syscall.EBUSY) {
+			t.Fatalf("Expected EBUSY, got '%v'", err)
+		}
+		testDirExists(t, mfs, "/sandbox", true)
+	})
+}
@@ -0,0 +1,84 @@
+package gofs
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Sleeper is a Clock that can also wait for time to pass.
+type Sleeper interface {
+	Clock
+	Sleep(d time.Duration)
+}
+
+type systemClock struct {
+}
+
+// SystemClock returns a Clock that reads the system time, and sleeps for real.
+func SystemClock() Sleeper {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// ManualClock is a Clock that only moves when told to, so that tests can
+// predict the exact times it returns.
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock creates a ManualClock that starts at the given time.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to the given time.
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Sleep advances the clock by d straight away, so that code sleeping on it runs
+// in virtual time. Time passes only as fast as that code sleeps, and two
+// goroutines sleeping at once both add to it.
+func (c *ManualClock) Sleep(d time.Duration) {
+	c.Advance(max(d, 0))
+}
+
+// SleepUntil moves the clock forward to t, unless it's already past it. Unlike
+// Sleep, goroutines sleeping until deadlines at once only take the clock as far
+// as the latest of them.
+func (c *ManualClock) SleepUntil(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
@@ -0,0 +1,169 @@
+package gofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type dirFs struct {
+	fsys FileSystem
+	dir  string
+}
+
+// DirFs is like os.DirFS, but it takes a FileSystem. The returned fs.FS also
+// implements fs.StatFS, fs.ReadDirFS, fs.ReadFileFS, fs.GlobFS and fs.SubFS.
+func DirFs(fsys FileSystem, dir string) fs.FS {
+	return &dirFs{
+		fsys: fsys,
+		dir:  dir,
+	}
+}
+
+// join validates an io/fs name and converts it to a path in the underlying
+// FileSystem.
+func (d *dirFs) join(op string, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{
+			Op:   op,
+			Err:  fs.ErrInvalid,
+			Path: name,
+		}
+	}
+	if name == "." {
+		return d.dir, nil
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name)), nil
+}
+
+// fixErr rewrites the path in an error returned by the underlying FileSystem
+// so that callers see the io/fs name they passed in.
+func fixErr(op string, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{
+			Op:   pe.Op,
+			Err:  pe.Err,
+			Path: name,
+		}
+	}
+	return &fs.PathError{
+		Op:   op,
+		Err:  err,
+		Path: name,
+	}
+}
+
+func (d *dirFs) Open(name string) (fs.File, error) {
+	path, err := d.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := d.fsys.Open(path)
+	if err != nil {
+		return nil, fixErr("open", name, err)
+	}
+	return &dirFsFile{File: file}, nil
+}
+
+func (d *dirFs) Stat(name string) (fs.FileInfo, error) {
+	path, err := d.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.fsys.Stat(path)
+	if err != nil {
+		return nil, fixErr("stat", name, err)
+	}
+	return info, nil
+}
+
+func (d *dirFs) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := d.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ReadDir(d.fsys, path)
+	if err != nil {
+		return nil, fixErr("readdir", name, err)
+	}
+	return toDirEntries(infos), nil
+}
+
+func (d *dirFs) ReadFile(name string) ([]byte, error) {
+	path, err := d.join("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ReadFile(d.fsys, path)
+	if err != nil {
+		return nil, fixErr("readfile", name, err)
+	}
+	return data, nil
+}
+
+func (d *dirFs) Glob(pattern string) ([]string, error) {
+	// Hide our own Glob method so fs.Glob doesn't call straight back into it.
+	return fs.Glob(struct{ fs.ReadDirFS }{d}, pattern)
+}
+
+func (d *dirFs) Sub(dir string) (fs.FS, error) {
+	path, err := d.join("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "." {
+		return d, nil
+	}
+	return &dirFs{
+		fsys: d.fsys,
+		dir:  path,
+	}, nil
+}
+
+func toDirEntries(infos []os.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries
+}
+
+// dirFsFile hands out a File's directory entries in name order, whatever order
+// the FileSystem lists them in. Entries are read once, on the first call to
+// ReadDir.
+type dirFsFile struct {
+	File
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (f *dirFsFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.read {
+		infos, err := f.File.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		f.entries = toDirEntries(infos)
+		f.read = true
+	}
+
+	if n <= 0 {
+		ret := f.entries
+		f.entries = nil
+		return ret, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+	ret := f.entries[:n]
+	f.entries = f.entries[n:]
+	return ret, nil
+}
@@ -0,0 +1,92 @@
+package gofs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func populateDirFs(fsys FileSystem, root string) {
+	fsys.MkdirAll(root+"/foo/bar", os.FileMode(0755))
+	fsys.Mkdir(root+"/empty", os.FileMode(0755))
+	WriteFile(fsys, root+"/hello", []byte("Hello World"), os.FileMode(0644))
+	WriteFile(fsys, root+"/foo/one", []byte("one"), os.FileMode(0644))
+	WriteFile(fsys, root+"/foo/bar/two", []byte("two"), os.FileMode(0600))
+}
+
+func TestDirFsOs(t *testing.T) {
+	root := t.TempDir()
+	populateDirFs(OsFs(), root)
+
+	err := fstest.TestFS(DirFs(OsFs(), root), "hello", "foo/one", "foo/bar/two", "empty")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestDirFsMock(t *testing.T) {
+	mfs := MockFs()
+	populateDirFs(mfs, "/root")
+
+	err := fstest.TestFS(DirFs(mfs, "/root"), "hello", "foo/one", "foo/bar/two", "empty")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestDirFs(t *testing.T) {
+	mfs := MockFs()
+	populateDirFs(mfs, "/root")
+
+	fsys := DirFs(mfs, "/root")
+
+	t.Run("Sub", func(t *testing.T) {
+		sub, err := fs.Sub(fsys, "foo")
+		if err != nil {
+			t.Fatalf("Unexpected error from Sub: %v", err)
+		}
+		data, err := fs.ReadFile(sub, "bar/two")
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadFile: %v", err)
+		}
+		if string(data) != "two" {
+			t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	t.Run("Glob", func(t *testing.T) {
+		matches, err := fs.Glob(fsys, "foo/*")
+		if err != nil {
+			t.Fatalf("Unexpected error from Glob: %v", err)
+		}
+		if len(matches) != 2 || matches[0] != "foo/bar" || matches[1] != "foo/one" {
+			t.Fatalf("Unexpected matches: %v", matches)
+		}
+	})
+
+	t.Run("InvalidPath", func(t *testing.T) {
+		for _, name := range []string{"/hello", "../hello", "foo/../hello", ""} {
+			_, err := fsys.Open(name)
+			var pe *fs.PathError
+			if !errors.As(err, &pe) || !errors.Is(err, fs.ErrInvalid) {
+				t.Fatalf("Expected fs.ErrInvalid for '%v', got '%v'", name, err)
+			}
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		_, err := fs.Stat(fsys, "foo/bogus")
+		var pe *fs.PathError
+		if !errors.As(err, &pe) {
+			t.Fatalf("Expected *fs.PathError, got '%v'", err)
+		}
+		if pe.Path != "foo/bogus" {
+			t.Fatalf("Unexpected path: '%v'", pe.Path)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("Expected fs.ErrNotExist, got '%v'", err)
+		}
+	})
+}
@@ -0,0 +1,474 @@
+package gofs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault is a rule for making calls to a FaultyFs fail.
+type Fault struct {
+	// Name identifies the fault in the log of those that fired.
+	Name string
+
+	// Op is the method to match, such as "OpenFile" or "Rename", or
+	// "File.Write" for a method of a File. Open and Create are matched as
+	// themselves, not as OpenFile. Empty matches every method.
+	Op string
+
+	// Path is a filepath.Match pattern for the path passed to the method, or
+	// the name of the File. Methods that take two paths match if either does.
+	// Empty matches every path.
+	Path string
+
+	// After skips that many matching calls before the fault fires, and Times
+	// limits how often it fires, with 0 meaning no limit.
+	After int
+	Times int
+
+	// Err is what the call returns, or syscall.EIO if it's nil. It's returned
+	// as is, so wrap it in an *os.PathError if the code under test looks for
+	// one.
+	Err error
+
+	// Short makes Read, ReadAt, Write and WriteAt transfer that many bytes, if
+	// they were asked for that many, before returning Err. A short Read may
+	// return a nil Err; for the others, it's replaced by io.EOF or
+	// io.ErrShortWrite as their interfaces require. A fault with Short set
+	// only matches those four methods, and with a nil Err, not a call for no
+	// more than Short bytes, which it would leave as it is.
+	Short int
+
+	// Panic makes the call panic with the given value instead.
+	Panic any
+}
+
+// FaultEvent records a Fault firing.
+type FaultEvent struct {
+	Name string
+	Op   string
+	Path string
+}
+
+// FaultyFs is a file system whose calls can be made to fail.
+type FaultyFs interface {
+	FileSystem
+
+	// Inject adds a fault. Faults are checked in the order they were added,
+	// and the first that matches a call fires.
+	Inject(fault Fault)
+
+	// Fired returns the faults that have fired, in order.
+	Fired() []FaultEvent
+}
+
+type faultyFilesystem struct {
+	fs FileSystem
+
+	// mu guards faults and fired.
+	mu     sync.Mutex
+	faults []*faultState
+	fired  []FaultEvent
+}
+
+// faultState is a Fault along with the number of calls it has matched and
+// fired on.
+type faultState struct {
+	Fault
+	matched int
+	fired   int
+}
+
+// Faulty wraps fs, and the Files it opens, so that calls matching any of
+// faults fail.
+func Faulty(fs FileSystem, faults ...Fault) FaultyFs {
+	ret := &faultyFilesystem{fs: fs}
+	for _, fault := range faults {
+		ret.Inject(fault)
+	}
+	return ret
+}
+
+func (fs *faultyFilesystem) Inject(fault Fault) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults = append(fs.faults, &faultState{Fault: fault})
+}
+
+func (fs *faultyFilesystem) Fired() []FaultEvent {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]FaultEvent(nil), fs.fired...)
+}
+
+// matches returns whether fault applies to a call to op with paths, which
+// transfers n bytes if it's a Read, ReadAt, Write or WriteAt, and has n of -1
+// otherwise.
+func (fault *faultState) matches(op string, n int, paths []string) bool {
+	if fault.Op != "" && fault.Op != op {
+		return false
+	}
+	if fault.Short != 0 && (n < 0 || (fault.Short >= n && fault.Err == nil)) {
+		return false
+	}
+	if fault.Path == "" {
+		return true
+	}
+	for _, path := range paths {
+		if ok, _ := filepath.Match(fault.Path, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the fault that fires for a call to op with paths, or nil if
+// none does.
+func (fs *faultyFilesystem) check(op string, paths ...string) *Fault {
+	return fs.checkTransfer(op, -1, paths...)
+}
+
+// checkTransfer is check for a call that transfers n bytes.
+func (fs *faultyFilesystem) checkTransfer(op string, n int, paths ...string) *Fault {
+	fs.mu.Lock()
+	var fired *Fault
+	for _, fault := range fs.faults {
+		if !fault.matches(op, n, paths) {
+			continue
+		}
+		fault.matched++
+		if fault.matched <= fault.After || (fault.Times > 0 && fault.fired >= fault.Times) {
+			continue
+		}
+		fault.fired++
+		fs.fired = append(fs.fired, FaultEvent{
+			Name: fault.Name,
+			Op:   op,
+			Path: paths[0],
+		})
+		fired = &fault.Fault
+		break
+	}
+	fs.mu.Unlock()
+
+	if fired != nil && fired.Panic != nil {
+		panic(fired.Panic)
+	}
+	return fired
+}
+
+// err returns the error the fault makes a call return.
+func (fault *Fault) err() error {
+	if fault.Err == nil {
+		return syscall.EIO
+	}
+	return fault.Err
+}
+
+func (fs *faultyFilesystem) Stat(name string) (os.FileInfo, error) {
+	if fault := fs.check("Stat", name); fault != nil {
+		return nil, fault.err()
+	}
+	return fs.fs.Stat(name)
+}
+
+func (fs *faultyFilesystem) Getwd() (string, error) {
+	if fault := fs.check("Getwd", ""); fault != nil {
+		return "", fault.err()
+	}
+	return fs.fs.Getwd()
+}
+
+func (fs *faultyFilesystem) Chdir(dir string) error {
+	if fault := fs.check("Chdir", dir); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Chdir(dir)
+}
+
+func (fs *faultyFilesystem) Abs(path string) (string, error) {
+	if fault := fs.check("Abs", path); fault != nil {
+		return "", fault.err()
+	}
+	return fs.fs.Abs(path)
+}
+
+func (fs *faultyFilesystem) Chmod(name string, mode os.FileMode) error {
+	if fault := fs.check("Chmod", name); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Chmod(name, mode)
+}
+
+func (fs *faultyFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if fault := fs.check("Chtimes", name); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Chtimes(name, atime, mtime)
+}
+
+func (fs *faultyFilesystem) Chown(name string, uid, gid int) error {
+	if fault := fs.check("Chown", name); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Chown(name, uid, gid)
+}
+
+func (fs *faultyFilesystem) Lchown(name string, uid, gid int) error {
+	if fault := fs.check("Lchown", name); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Lchown(name, uid, gid)
+}
+
+func (fs *faultyFilesystem) Lstat(name string) (os.FileInfo, error) {
+	if fault := fs.check("Lstat", name); fault != nil {
+		return nil, fault.err()
+	}
+	return fs.fs.Lstat(name)
+}
+
+func (fs *faultyFilesystem) Readlink(name string) (string, error) {
+	if fault := fs.check("Readlink", name); fault != nil {
+		return "", fault.err()
+	}
+	return fs.fs.Readlink(name)
+}
+
+func (fs *faultyFilesystem) Symlink(oldname, newname string) error {
+	if fault := fs.check("Symlink", newname, oldname); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Symlink(oldname, newname)
+}
+
+func (fs *faultyFilesystem) Link(oldname, newname string) error {
+	if fault := fs.check("Link", newname, oldname); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Link(oldname, newname)
+}
+
+func (fs *faultyFilesystem) Mkdir(path string, perm os.FileMode) error {
+	if fault := fs.check("Mkdir", path); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Mkdir(path, perm)
+}
+
+func (fs *faultyFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	if fault := fs.check("MkdirAll", path); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.MkdirAll(path, perm)
+}
+
+// file wraps a File opened from the underlying FileSystem.
+func (fs *faultyFilesystem) file(file File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{
+		File: file,
+		fs:   fs,
+	}, nil
+}
+
+func (fs *faultyFilesystem) Open(name string) (File, error) {
+	if fault := fs.check("Open", name); fault != nil {
+		return nil, fault.err()
+	}
+	return fs.file(fs.fs.Open(name))
+}
+
+func (fs *faultyFilesystem) Create(name string) (File, error) {
+	if fault := fs.check("Create", name); fault != nil {
+		return nil, fault.err()
+	}
+	return fs.file(fs.fs.Create(name))
+}
+
+func (fs *faultyFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if fault := fs.check("OpenFile", name); fault != nil {
+		return nil, fault.err()
+	}
+	return fs.file(fs.fs.OpenFile(name, flag, perm))
+}
+
+func (fs *faultyFilesystem) Truncate(name string, size int64) error {
+	if fault := fs.check("Truncate", name); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Truncate(name, size)
+}
+
+func (fs *faultyFilesystem) Remove(name string) error {
+	if fault := fs.check("Remove", name); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Remove(name)
+}
+
+func (fs *faultyFilesystem) RemoveAll(path string) error {
+	if fault := fs.check("RemoveAll", path); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.RemoveAll(path)
+}
+
+func (fs *faultyFilesystem) Rename(oldpath, newpath string) error {
+	if fault := fs.check("Rename", oldpath, newpath); fault != nil {
+		return fault.err()
+	}
+	return fs.fs.Rename(oldpath, newpath)
+}
+
+// faultyFile is a File opened through Faulty.
+type faultyFile struct {
+	File
+	fs *faultyFilesystem
+}
+
+// short returns the part of b that a fault lets through.
+func (fault *Fault) short(b []byte) []byte {
+	return b[:min(len(b), fault.Short)]
+}
+
+func (f *faultyFile) Stat() (os.FileInfo, error) {
+	if fault := f.fs.check("File.Stat", f.Name()); fault != nil {
+		return nil, fault.err()
+	}
+	return f.File.Stat()
+}
+
+func (f *faultyFile) Chmod(mode os.FileMode) error {
+	if fault := f.fs.check("File.Chmod", f.Name()); fault != nil {
+		return fault.err()
+	}
+	return f.File.Chmod(mode)
+}
+
+func (f *faultyFile) Readdir(n int) ([]os.FileInfo, error) {
+	if fault := f.fs.check("File.Readdir", f.Name()); fault != nil {
+		return nil, fault.err()
+	}
+	return f.File.Readdir(n)
+}
+
+func (f *faultyFile) Readdirnames(n int) ([]string, error) {
+	if fault := f.fs.check("File.Readdirnames", f.Name()); fault != nil {
+		return nil, fault.err()
+	}
+	return f.File.Readdirnames(n)
+}
+
+func (f *faultyFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if fault := f.fs.check("File.ReadDir", f.Name()); fault != nil {
+		return nil, fault.err()
+	}
+	return f.File.ReadDir(n)
+}
+
+func (f *faultyFile) Read(b []byte) (int, error) {
+	fault := f.fs.checkTransfer("File.Read", len(b), f.Name())
+	if fault == nil {
+		return f.File.Read(b)
+	}
+	if fault.Short == 0 {
+		return 0, fault.err()
+	}
+	n, err := f.File.Read(fault.short(b))
+	if err == nil {
+		err = fault.Err
+	}
+	return n, err
+}
+
+func (f *faultyFile) ReadAt(b []byte, off int64) (int, error) {
+	fault := f.fs.checkTransfer("File.ReadAt", len(b), f.Name())
+	if fault == nil {
+		return f.File.ReadAt(b, off)
+	}
+	if fault.Short == 0 {
+		return 0, fault.err()
+	}
+	n, err := f.File.ReadAt(fault.short(b), off)
+	if err == nil {
+		err = fault.Err
+	}
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *faultyFile) Write(b []byte) (int, error) {
+	fault := f.fs.checkTransfer("File.Write", len(b), f.Name())
+	if fault == nil {
+		return f.File.Write(b)
+	}
+	if fault.Short == 0 {
+		return 0, fault.err()
+	}
+	n, err := f.File.Write(fault.short(b))
+	if err == nil {
+		err = fault.Err
+	}
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+func (f *faultyFile) WriteAt(b []byte, off int64) (int, error) {
+	fault := f.fs.checkTransfer("File.WriteAt", len(b), f.Name())
+	if fault == nil {
+		return f.File.WriteAt(b, off)
+	}
+	if fault.Short == 0 {
+		return 0, fault.err()
+	}
+	n, err := f.File.WriteAt(fault.short(b), off)
+	if err == nil {
+		err = fault.Err
+	}
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+func (f *faultyFile) Seek(offset int64, whence int) (int64, error) {
+	if fault := f.fs.check("File.Seek", f.Name()); fault != nil {
+		return 0, fault.err()
+	}
+	return f.File.Seek(offset, whence)
+}
+
+func (f *faultyFile) Truncate(size int64) error {
+	if fault := f.fs.check("File.Truncate", f.Name()); fault != nil {
+		return fault.err()
+	}
+	return f.File.Truncate(size)
+}
+
+func (f *faultyFile) Sync() error {
+	if fault := f.fs.check("File.Sync", f.Name()); fault != nil {
+		return fault.err()
+	}
+	return f.File.Sync()
+}
+
+func (f *faultyFile) Close() error {
+	// Like close(2), the file is closed even if it fails.
+	fault := f.fs.check("File.Close", f.Name())
+	err := f.File.Close()
+	if fault != nil {
+		return fault.err()
+	}
+	return err
+}
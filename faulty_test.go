@@ -0,0 +1,137 @@
+package gofs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestFaulty(t *testing.T) {
+	mfs := MockFs()
+	mfs.MkdirAll("/dir", os.FileMode(0755))
+	WriteFile(mfs, "/dir/file", []byte("Hello World"), os.FileMode(0644))
+
+	t.Run("Error", func(t *testing.T) {
+		fs := Faulty(mfs, Fault{Name: "rename", Op: "Rename", Path: "/dir/*"})
+		if err := fs.Rename("/dir/file", "/dir/other"); !errors.Is(err, syscall.EIO) {
+			t.Fatalf("Expected EIO, got '%v'", err)
+		}
+		testFileExists(t, mfs, "/dir/file", true)
+
+		// Other operations and paths are left alone.
+		testReadFile(t, fs, "/dir/file", "Hello World")
+		if err := fs.Mkdir("/other", os.FileMode(0755)); err != nil {
+			t.Fatalf("Unexpected error from Mkdir: %v", err)
+		}
+		if err := fs.Rename("/other", "/moved"); err != nil {
+			t.Fatalf("Unexpected error from Rename: %v", err)
+		}
+
+		expected := []FaultEvent{{Name: "rename", Op: "Rename", Path: "/dir/file"}}
+		if fired := fs.Fired(); !reflect.DeepEqual(fired, expected) {
+			t.Fatalf("Unexpected log: %v", fired)
+		}
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		fs := Faulty(mfs, Fault{Op: "Stat", After: 1, Times: 2, Err: os.ErrPermission})
+		var failed []bool
+		for range 5 {
+			_, err := fs.Stat("/dir/file")
+			failed = append(failed, errors.Is(err, os.ErrPermission))
+		}
+		if !reflect.DeepEqual(failed, []bool{false, true, true, false, false}) {
+			t.Fatalf("Unexpected failures: %v", failed)
+		}
+	})
+
+	t.Run("ShortWrite", func(t *testing.T) {
+		fs := Faulty(mfs, Fault{Op: "File.Write", Short: 3, Err: syscall.ENOSPC})
+		f, err := fs.Create("/dir/new")
+		if err != nil {
+			t.Fatalf("Unexpected error from Create: %v", err)
+		}
+		n, err := f.Write([]byte("Hello"))
+		if n != 3 || !errors.Is(err, syscall.ENOSPC) {
+			t.Fatalf("Unexpected write result: %v, %v", n, err)
+		}
+		f.Close()
+		testReadFile(t, mfs, "/dir/new", "Hel")
+	})
+
+	t.Run("ShortRead", func(t *testing.T) {
+		fs := Faulty(mfs, Fault{Op: "File.Read", Short: 5, Times: 1})
+		f, err := fs.Open("/dir/file")
+		if err != nil {
+			t.Fatalf("Unexpected error from Open: %v", err)
+		}
+		defer f.Close()
+		b := make([]byte, 20)
+		n, err := f.Read(b)
+		if n != 5 || err != nil {
+			t.Fatalf("Unexpected read result: %v, %v", n, err)
+		}
+		// Callers that keep reading get the rest.
+		rest, err := io.ReadAll(f)
+		if string(b[:n])+string(rest) != "Hello World" || err != nil {
+			t.Fatalf("Unexpected read result: '%v', %v", string(rest), err)
+		}
+	})
+
+	t.Run("ShortNoop", func(t *testing.T) {
+		fs := Faulty(mfs, Fault{Name: "short", Op: "File.Write", Short: 5, Times: 1})
+		f, err := fs.Create("/dir/noop")
+		if err != nil {
+			t.Fatalf("Unexpected error from Create: %v", err)
+		}
+		defer f.Close()
+		// Writes that fit don't use up the fault.
+		for _, s := range []string{"Hi", "Hello"} {
+			if n, err := f.Write([]byte(s)); n != len(s) || err != nil {
+				t.Fatalf("Unexpected write result: %v, %v", n, err)
+			}
+		}
+		if fired := fs.Fired(); len(fired) != 0 {
+			t.Fatalf("Unexpected log: %v", fired)
+		}
+		n, err := f.Write([]byte("Hello World"))
+		if n != 5 || !errors.Is(err, io.ErrShortWrite) {
+			t.Fatalf("Unexpected write result: %v, %v", n, err)
+		}
+		if fired := fs.Fired(); len(fired) != 1 || fired[0].Name != "short" {
+			t.Fatalf("Unexpected log: %v", fired)
+		}
+	})
+
+	t.Run("ShortAnyOp", func(t *testing.T) {
+		fs := Faulty(mfs, Fault{Short: 2, Err: syscall.EIO})
+		if _, err := fs.Stat("/dir/file"); err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		f, err := fs.Open("/dir/file")
+		if err != nil {
+			t.Fatalf("Unexpected error from Open: %v", err)
+		}
+		defer f.Close()
+		n, err := f.Read(make([]byte, 5))
+		if n != 2 || !errors.Is(err, syscall.EIO) {
+			t.Fatalf("Unexpected read result: %v, %v", n, err)
+		}
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		fs := Faulty(mfs, Fault{Name: "boom", Op: "Remove", Panic: "boom"})
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("Unexpected panic: %v", r)
+			}
+			if fired := fs.Fired(); len(fired) != 1 || fired[0].Name != "boom" {
+				t.Fatalf("Unexpected log: %v", fired)
+			}
+		}()
+		fs.Remove("/dir/file")
+	})
+}
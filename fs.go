@@ -2,9 +2,12 @@ package gofs
 
 import (
 	"io"
+	iofs "io/fs"
 	"io/ioutil"
 	"os"
 	"sort"
+	"syscall"
+	"time"
 )
 
 // File is like os.File, but an interface.
@@ -13,12 +16,21 @@ type File interface {
 	io.Writer
 	io.Closer
 
+	// ReadAt and WriteAt are like pread and pwrite: they don't use or move the
+	// file's offset.
+	io.ReaderAt
+	io.WriterAt
+
 	Name() string
 	Stat() (os.FileInfo, error)
 
 	Chmod(mode os.FileMode) error
 
+	// Readdir, Readdirnames and ReadDir share a cursor, so each call carries on
+	// where the last one left off.
 	Readdir(n int) ([]os.FileInfo, error)
+	Readdirnames(n int) ([]string, error)
+	ReadDir(n int) ([]iofs.DirEntry, error)
 
 	Seek(offset int64, whence int) (int64, error)
 	Truncate(size int64) error
@@ -36,10 +48,14 @@ type FileSystem interface {
 	Abs(path string) (string, error)
 
 	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+	Chown(name string, uid, gid int) error
+	Lchown(name string, uid, gid int) error
 
 	Lstat(name string) (os.FileInfo, error)
 	Readlink(name string) (string, error)
 	Symlink(oldname, newname string) error
+	Link(oldname, newname string) error
 
 	Mkdir(path string, perm os.FileMode) error
 	MkdirAll(path string, perm os.FileMode) error
@@ -113,3 +129,45 @@ func ReadDir(fs FileSystem, dirname string) ([]os.FileInfo, error) {
 	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
 	return list, nil
 }
+
+// mkdirAll is os.MkdirAll for any FileSystem, built out of its Stat, Lstat and
+// Mkdir.
+func mkdirAll(fs FileSystem, path string, perm os.FileMode) error {
+	info, err := fs.Stat(path)
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{
+			Op:   "mkdir",
+			Err:  syscall.ENOTDIR,
+			Path: path,
+		}
+	}
+
+	// Strip trailing slashes, then the last component, and make the parent.
+	i := len(path)
+	for i > 0 && path[i-1] == '/' {
+		i--
+	}
+	j := i
+	for j > 0 && path[j-1] != '/' {
+		j--
+	}
+	if j > 1 {
+		if err := mkdirAll(fs, path[:j-1], perm); err != nil {
+			return err
+		}
+	}
+
+	err = fs.Mkdir(path, perm)
+	if err != nil {
+		// Handle arguments like "foo/." by double-checking that it exists.
+		info, lerr := fs.Lstat(path)
+		if lerr == nil && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
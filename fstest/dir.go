@@ -0,0 +1,348 @@
+package fstest
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/fernomac/gofs"
+)
+
+func testDir(t *testing.T, factory Factory) {
+	run(t, factory, "Mkdir", func(e *env) {
+		checkNil(e.t, e.fs.Mkdir(e.path("dir"), os.FileMode(0755)), "Mkdir")
+		fi, err := e.fs.Stat(e.path("dir"))
+		checkNil(e.t, err, "Stat")
+		if !fi.IsDir() || fi.Mode().Perm() != os.FileMode(0755) {
+			e.t.Fatalf("Unexpected mode: %v", fi.Mode())
+		}
+	})
+
+	mkdirErrors := []struct {
+		name string
+		path string
+		want error
+	}{
+		{"Exists", "dir", syscall.EEXIST},
+		{"File", "file", syscall.EEXIST},
+		{"Symlink", "link", syscall.EEXIST},
+		{"Dangling", "dangling", syscall.EEXIST},
+		{"MissingParent", "missing/dir", syscall.ENOENT},
+		{"FileParent", "file/dir", syscall.ENOTDIR},
+	}
+	for _, c := range mkdirErrors {
+		run(t, factory, "Mkdir"+c.name, func(e *env) {
+			e.mkdir("dir")
+			e.writeFile("file", "")
+			e.symlink("dir", "link")
+			e.symlink("missing", "dangling")
+			err := e.fs.Mkdir(e.path(c.path), os.FileMode(0755))
+			checkPathError(e.t, err, "mkdir", c.want)
+		})
+	}
+
+	run(t, factory, "MkdirAll", func(e *env) {
+		checkNil(e.t, e.fs.MkdirAll(e.path("a/b/c"), os.FileMode(0755)), "MkdirAll")
+		for _, name := range []string{"a", "a/b", "a/b/c"} {
+			e.checkType(name, os.ModeDir)
+		}
+	})
+
+	run(t, factory, "MkdirAllExists", func(e *env) {
+		e.mkdir("a/b")
+		checkNil(e.t, e.fs.MkdirAll(e.path("a/b"), os.FileMode(0755)), "MkdirAll")
+		checkNil(e.t, e.fs.MkdirAll(e.path("a"), os.FileMode(0755)), "MkdirAll")
+	})
+
+	run(t, factory, "MkdirAllThroughSymlink", func(e *env) {
+		e.mkdir("dir")
+		e.symlink("dir", "link")
+		checkNil(e.t, e.fs.MkdirAll(e.path("link/a/b"), os.FileMode(0755)), "MkdirAll")
+		e.checkType("dir/a/b", os.ModeDir)
+	})
+
+	run(t, factory, "MkdirAllFile", func(e *env) {
+		e.writeFile("file", "")
+		err := e.fs.MkdirAll(e.path("file"), os.FileMode(0755))
+		checkPathError(e.t, err, "mkdir", syscall.ENOTDIR)
+	})
+
+	run(t, factory, "MkdirAllThroughFile", func(e *env) {
+		e.writeFile("file", "")
+		err := e.fs.MkdirAll(e.path("file/a/b"), os.FileMode(0755))
+		checkPathError(e.t, err, "mkdir", syscall.ENOTDIR)
+	})
+
+	run(t, factory, "RemoveFile", func(e *env) {
+		e.writeFile("file", "")
+		checkNil(e.t, e.fs.Remove(e.path("file")), "Remove")
+		e.checkMissing("file")
+	})
+
+	run(t, factory, "RemoveDir", func(e *env) {
+		e.mkdir("dir")
+		checkNil(e.t, e.fs.Remove(e.path("dir")), "Remove")
+		e.checkMissing("dir")
+	})
+
+	run(t, factory, "RemoveSymlink", func(e *env) {
+		e.mkdir("dir")
+		e.symlink("dir", "link")
+		checkNil(e.t, e.fs.Remove(e.path("link")), "Remove")
+		e.checkMissing("link")
+		e.checkType("dir", os.ModeDir)
+	})
+
+	run(t, factory, "RemoveDangling", func(e *env) {
+		e.symlink("missing", "link")
+		checkNil(e.t, e.fs.Remove(e.path("link")), "Remove")
+		e.checkMissing("link")
+	})
+
+	removeErrors := []struct {
+		name string
+		path string
+		want error
+	}{
+		{"NotEmpty", "dir", syscall.ENOTEMPTY},
+		{"Missing", "missing", syscall.ENOENT},
+		{"MissingParent", "missing/file", syscall.ENOENT},
+		{"FileParent", "dir/file/x", syscall.ENOTDIR},
+	}
+	for _, c := range removeErrors {
+		run(t, factory, "Remove"+c.name, func(e *env) {
+			e.mkdir("dir")
+			e.writeFile("dir/file", "")
+			checkPathError(e.t, e.fs.Remove(e.path(c.path)), "remove", c.want)
+		})
+	}
+
+	run(t, factory, "RemoveAll", func(e *env) {
+		e.mkdir("dir/a/b")
+		e.writeFile("dir/a/b/file", "")
+		e.writeFile("dir/file", "")
+		e.symlink("..", "dir/a/up")
+		checkNil(e.t, e.fs.RemoveAll(e.path("dir")), "RemoveAll")
+		e.checkMissing("dir")
+	})
+
+	run(t, factory, "RemoveAllFile", func(e *env) {
+		e.writeFile("file", "")
+		checkNil(e.t, e.fs.RemoveAll(e.path("file")), "RemoveAll")
+		e.checkMissing("file")
+	})
+
+	run(t, factory, "RemoveAllSymlink", func(e *env) {
+		e.mkdir("dir")
+		e.writeFile("dir/file", "")
+		e.symlink("dir", "link")
+		checkNil(e.t, e.fs.RemoveAll(e.path("link")), "RemoveAll")
+		e.checkMissing("link")
+		e.checkFile("dir/file", "")
+	})
+
+	run(t, factory, "RemoveAllMissing", func(e *env) {
+		checkNil(e.t, e.fs.RemoveAll(e.path("missing")), "RemoveAll")
+		checkNil(e.t, e.fs.RemoveAll(e.path("missing/file")), "RemoveAll")
+	})
+
+	run(t, factory, "Readdir", func(e *env) {
+		e.mkdir("dir/sub")
+		e.writeFile("dir/file", "hello")
+		e.symlink("file", "dir/link")
+
+		f := e.open("dir", os.O_RDONLY)
+		list, err := f.Readdir(-1)
+		checkNil(e.t, err, "Readdir")
+		sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+
+		want := []struct {
+			name string
+			typ  os.FileMode
+		}{
+			{"file", 0},
+			{"link", os.ModeSymlink},
+			{"sub", os.ModeDir},
+		}
+		if len(list) != len(want) {
+			e.t.Fatalf("Unexpected entries: %v", list)
+		}
+		for i, w := range want {
+			if list[i].Name() != w.name || list[i].Mode()&os.ModeType != w.typ {
+				e.t.Fatalf("Unexpected entry: %v %v", list[i].Name(), list[i].Mode())
+			}
+		}
+		if list[0].Size() != 5 {
+			e.t.Fatalf("Unexpected size: %v", list[0].Size())
+		}
+	})
+
+	run(t, factory, "ReaddirEmpty", func(e *env) {
+		e.mkdir("dir")
+		f := e.open("dir", os.O_RDONLY)
+		list, err := f.Readdir(-1)
+		checkNil(e.t, err, "Readdir")
+		if len(list) != 0 {
+			e.t.Fatalf("Unexpected entries: %v", list)
+		}
+	})
+
+	run(t, factory, "ReaddirAfterRemove", func(e *env) {
+		e.mkdir("dir")
+		e.writeFile("dir/a", "")
+		e.writeFile("dir/b", "")
+		checkNil(e.t, e.fs.Remove(e.path("dir/a")), "Remove")
+		list, err := gofs.ReadDir(e.fs, e.path("dir"))
+		checkNil(e.t, err, "ReadDir")
+		if len(list) != 1 || list[0].Name() != "b" {
+			e.t.Fatalf("Unexpected entries: %v", list)
+		}
+	})
+
+	run(t, factory, "ReaddirPaging", func(e *env) {
+		e.mkdir("dir")
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			e.writeFile("dir/"+name, "")
+		}
+
+		f := e.open("dir", os.O_RDONLY)
+		seen := map[string]bool{}
+		for _, want := range []int{2, 2, 1} {
+			list, err := f.Readdir(2)
+			checkNil(e.t, err, "Readdir")
+			if len(list) != want {
+				e.t.Fatalf("Expected %v entries, got %v", want, len(list))
+			}
+			for _, fi := range list {
+				if seen[fi.Name()] {
+					e.t.Fatalf("Entry %v returned twice", fi.Name())
+				}
+				seen[fi.Name()] = true
+			}
+		}
+		list, err := f.Readdir(2)
+		if len(list) != 0 || err != io.EOF {
+			e.t.Fatalf("Expected EOF, got %v, '%v'", list, err)
+		}
+		list, err = f.Readdir(-1)
+		if len(list) != 0 || err != nil {
+			e.t.Fatalf("Expected nothing, got %v, '%v'", list, err)
+		}
+	})
+
+	run(t, factory, "ReaddirEmptyPaging", func(e *env) {
+		e.mkdir("dir")
+		f := e.open("dir", os.O_RDONLY)
+		list, err := f.Readdir(1)
+		if len(list) != 0 || err != io.EOF {
+			e.t.Fatalf("Expected EOF, got %v, '%v'", list, err)
+		}
+	})
+
+	run(t, factory, "Readdirnames", func(e *env) {
+		e.mkdir("dir/sub")
+		e.writeFile("dir/file", "")
+		f := e.open("dir", os.O_RDONLY)
+		names, err := f.Readdirnames(-1)
+		checkNil(e.t, err, "Readdirnames")
+		sort.Strings(names)
+		if strings.Join(names, ",") != "file,sub" {
+			e.t.Fatalf("Unexpected names: %v", names)
+		}
+		names, err = f.Readdirnames(1)
+		if len(names) != 0 || err != io.EOF {
+			e.t.Fatalf("Expected EOF, got %v, '%v'", names, err)
+		}
+	})
+
+	run(t, factory, "ReadDirEntries", func(e *env) {
+		e.mkdir("dir/sub")
+		e.writeFile("dir/file", "hello")
+		e.symlink("file", "dir/link")
+		f := e.open("dir", os.O_RDONLY)
+		entries, err := f.ReadDir(-1)
+		checkNil(e.t, err, "ReadDir")
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+		want := []struct {
+			name string
+			typ  os.FileMode
+		}{
+			{"file", 0},
+			{"link", os.ModeSymlink},
+			{"sub", os.ModeDir},
+		}
+		if len(entries) != len(want) {
+			e.t.Fatalf("Unexpected entries: %v", entries)
+		}
+		for i, w := range want {
+			if entries[i].Name() != w.name || entries[i].Type() != w.typ || entries[i].IsDir() != (w.typ == os.ModeDir) {
+				e.t.Fatalf("Unexpected entry: %v %v", entries[i].Name(), entries[i].Type())
+			}
+		}
+		info, err := entries[0].Info()
+		checkNil(e.t, err, "Info")
+		if info.Size() != 5 {
+			e.t.Fatalf("Unexpected size: %v", info.Size())
+		}
+	})
+
+	run(t, factory, "SharedCursor", func(e *env) {
+		e.mkdir("dir")
+		for _, name := range []string{"a", "b", "c"} {
+			e.writeFile("dir/"+name, "")
+		}
+		f := e.open("dir", os.O_RDONLY)
+		seen := map[string]bool{}
+		list, err := f.Readdir(1)
+		checkNil(e.t, err, "Readdir")
+		seen[list[0].Name()] = true
+		names, err := f.Readdirnames(1)
+		checkNil(e.t, err, "Readdirnames")
+		seen[names[0]] = true
+		entries, err := f.ReadDir(-1)
+		checkNil(e.t, err, "ReadDir")
+		if len(entries) != 1 || seen[entries[0].Name()] {
+			e.t.Fatalf("Unexpected entries: %v", entries)
+		}
+		if _, err := f.ReadDir(1); err != io.EOF {
+			e.t.Fatalf("Expected EOF, got '%v'", err)
+		}
+	})
+
+	run(t, factory, "ReaddirRewind", func(e *env) {
+		e.mkdir("dir")
+		e.writeFile("dir/a", "")
+		e.writeFile("dir/b", "")
+		f := e.open("dir", os.O_RDONLY)
+		_, err := f.Readdir(-1)
+		checkNil(e.t, err, "Readdir")
+		pos, err := f.Seek(0, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		if pos != 0 {
+			e.t.Fatalf("Unexpected position: %v", pos)
+		}
+		names, err := f.Readdirnames(-1)
+		checkNil(e.t, err, "Readdirnames")
+		if len(names) != 2 {
+			e.t.Fatalf("Unexpected names: %v", names)
+		}
+	})
+
+	run(t, factory, "ReaddirnamesFile", func(e *env) {
+		e.writeFile("file", "")
+		f := e.open("file", os.O_RDONLY)
+		_, err := f.Readdirnames(-1)
+		checkPathError(e.t, err, "readdirent", syscall.ENOTDIR)
+		_, err = f.ReadDir(-1)
+		checkPathError(e.t, err, "readdirent", syscall.ENOTDIR)
+	})
+
+	run(t, factory, "ReadDirMissing", func(e *env) {
+		_, err := gofs.ReadDir(e.fs, e.path("missing"))
+		checkPathError(e.t, err, "open", syscall.ENOENT)
+	})
+}
@@ -0,0 +1,583 @@
+package fstest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/fernomac/gofs"
+)
+
+// Seeking for data and holes in sparse files, with the whence values Linux
+// uses, and the block size they're tracked in on most Linux file systems.
+const (
+	seekData  = 3
+	seekHole  = 4
+	blockSize = 4096
+)
+
+func testFile(t *testing.T, factory Factory) {
+	run(t, factory, "ReadWrite", func(e *env) {
+		f := e.open("file", os.O_RDWR|os.O_CREATE)
+		n, err := f.Write([]byte("hello world"))
+		checkNil(e.t, err, "Write")
+		if n != 11 {
+			e.t.Fatalf("Unexpected write count: %v", n)
+		}
+		_, err = f.Seek(0, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		data, err := io.ReadAll(f)
+		checkNil(e.t, err, "Read")
+		if string(data) != "hello world" {
+			e.t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	run(t, factory, "ReadEmpty", func(e *env) {
+		e.writeFile("file", "")
+		f := e.open("file", os.O_RDONLY)
+		n, err := f.Read(make([]byte, 10))
+		if n != 0 || err != io.EOF {
+			e.t.Fatalf("Expected EOF, got %v, '%v'", n, err)
+		}
+	})
+
+	run(t, factory, "ReadPartial", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDONLY)
+		buf := make([]byte, 5)
+		for _, want := range []string{"hello", " worl", "d"} {
+			n, err := f.Read(buf)
+			checkNil(e.t, err, "Read")
+			if string(buf[:n]) != want {
+				e.t.Fatalf("Unexpected read result: '%v'", string(buf[:n]))
+			}
+		}
+		n, err := f.Read(buf)
+		if n != 0 || err != io.EOF {
+			e.t.Fatalf("Expected EOF, got %v, '%v'", n, err)
+		}
+	})
+
+	run(t, factory, "ReadEmptyBuffer", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDONLY)
+		n, err := f.Read(nil)
+		if n != 0 || err != nil {
+			e.t.Fatalf("Expected nothing, got %v, '%v'", n, err)
+		}
+	})
+
+	run(t, factory, "Overwrite", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_WRONLY)
+		_, err := f.Seek(6, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		_, err = f.Write([]byte("WORLD"))
+		checkNil(e.t, err, "Write")
+		e.checkFile("file", "hello WORLD")
+	})
+
+	run(t, factory, "OverwritePastEnd", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_WRONLY)
+		_, err := f.Seek(6, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		_, err = f.Write([]byte("there, world"))
+		checkNil(e.t, err, "Write")
+		e.checkFile("file", "hello there, world")
+	})
+
+	run(t, factory, "WriteEmpty", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_WRONLY)
+		n, err := f.Write(nil)
+		if n != 0 || err != nil {
+			e.t.Fatalf("Expected nothing, got %v, '%v'", n, err)
+		}
+		e.checkFile("file", "hello")
+	})
+
+	seeks := []struct {
+		name   string
+		offset int64
+		whence int
+		want   int64
+	}{
+		{"Start", 0, io.SeekStart, 0},
+		{"Set", 3, io.SeekStart, 3},
+		{"SetEnd", 11, io.SeekStart, 11},
+		{"Current", 2, io.SeekCurrent, 6},
+		{"CurrentBack", -2, io.SeekCurrent, 2},
+		{"CurrentZero", 0, io.SeekCurrent, 4},
+		{"CurrentToStart", -4, io.SeekCurrent, 0},
+		{"CurrentPastEnd", 100, io.SeekCurrent, 104},
+		{"PastEnd", 20, io.SeekStart, 20},
+		{"End", 0, io.SeekEnd, 11},
+		{"EndBack", -3, io.SeekEnd, 8},
+		{"EndToStart", -11, io.SeekEnd, 0},
+		{"EndPastEnd", 5, io.SeekEnd, 16},
+	}
+	for _, s := range seeks {
+		run(t, factory, "Seek"+s.name, func(e *env) {
+			e.writeFile("file", "hello world")
+			f := e.open("file", os.O_RDONLY)
+			_, err := f.Seek(4, io.SeekStart)
+			checkNil(e.t, err, "Seek")
+			pos, err := f.Seek(s.offset, s.whence)
+			checkNil(e.t, err, "Seek")
+			if pos != s.want {
+				e.t.Fatalf("Unexpected position: %v", pos)
+			}
+		})
+	}
+
+	badSeeks := []struct {
+		name   string
+		offset int64
+		whence int
+	}{
+		{"Negative", -1, io.SeekStart},
+		{"CurrentNegative", -5, io.SeekCurrent},
+		{"EndNegative", -12, io.SeekEnd},
+		{"Whence", 0, 7},
+	}
+	for _, s := range badSeeks {
+		run(t, factory, "Seek"+s.name, func(e *env) {
+			e.writeFile("file", "hello world")
+			f := e.open("file", os.O_RDONLY)
+			_, err := f.Seek(4, io.SeekStart)
+			checkNil(e.t, err, "Seek")
+			_, err = f.Seek(s.offset, s.whence)
+			checkPathError(e.t, err, "seek", syscall.EINVAL)
+
+			// The position is unchanged.
+			pos, err := f.Seek(0, io.SeekCurrent)
+			checkNil(e.t, err, "Seek")
+			if pos != 4 {
+				e.t.Fatalf("Unexpected position: %v", pos)
+			}
+		})
+	}
+
+	run(t, factory, "ReadPastEnd", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDONLY)
+		_, err := f.Seek(10, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		n, err := f.Read(make([]byte, 5))
+		if n != 0 || err != io.EOF {
+			e.t.Fatalf("Expected EOF, got %v, '%v'", n, err)
+		}
+	})
+
+	run(t, factory, "WritePastEnd", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDWR)
+		_, err := f.Seek(3, io.SeekEnd)
+		checkNil(e.t, err, "Seek")
+		_, err = f.Write([]byte("world"))
+		checkNil(e.t, err, "Write")
+		e.checkPosition(f, 13)
+		e.checkFile("file", "hello\x00\x00\x00world")
+	})
+
+	run(t, factory, "SeekPastEndThenTruncate", func(e *env) {
+		// Seeking alone doesn't change the size.
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDWR)
+		_, err := f.Seek(100, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		fi, err := f.Stat()
+		checkNil(e.t, err, "Stat")
+		if fi.Size() != 5 {
+			e.t.Fatalf("Unexpected size: %v", fi.Size())
+		}
+	})
+
+	// A sparse file: data in the first block, a hole, then data in the third
+	// block up to the end.
+	sparse := func(e *env) gofs.File {
+		f := e.open("file", os.O_RDWR|os.O_CREATE)
+		_, err := f.Write([]byte("hello"))
+		checkNil(e.t, err, "Write")
+		_, err = f.WriteAt([]byte("world"), 2*blockSize)
+		checkNil(e.t, err, "WriteAt")
+		return f
+	}
+	holes := []struct {
+		name   string
+		offset int64
+		whence int
+		want   int64
+	}{
+		{"DataAtStart", 0, seekData, 0},
+		{"DataInData", 3, seekData, 3},
+		{"DataInHole", blockSize, seekData, 2 * blockSize},
+		{"DataInLastBlock", 2*blockSize + 2, seekData, 2*blockSize + 2},
+		{"HoleAtStart", 0, seekHole, blockSize},
+		{"HoleInHole", blockSize + 10, seekHole, blockSize + 10},
+		{"HoleInLastBlock", 2 * blockSize, seekHole, 2*blockSize + 5},
+	}
+	for _, c := range holes {
+		run(t, factory, "Seek"+c.name, func(e *env) {
+			f := sparse(e)
+			pos, err := f.Seek(c.offset, c.whence)
+			checkNil(e.t, err, "Seek")
+			if pos != c.want {
+				e.t.Fatalf("Unexpected position: %v", pos)
+			}
+			e.checkPosition(f, c.want)
+		})
+	}
+
+	noHoles := []struct {
+		name   string
+		offset int64
+		whence int
+	}{
+		{"DataAtEnd", 2*blockSize + 5, seekData},
+		{"DataPastEnd", 3 * blockSize, seekData},
+		{"HoleAtEnd", 2*blockSize + 5, seekHole},
+		{"HoleNegative", -1, seekHole},
+	}
+	for _, c := range noHoles {
+		run(t, factory, "Seek"+c.name, func(e *env) {
+			f := sparse(e)
+			_, err := f.Seek(c.offset, c.whence)
+			checkPathError(e.t, err, "seek", syscall.ENXIO)
+		})
+	}
+
+	run(t, factory, "SeekDataTrailingHole", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDWR)
+		checkNil(e.t, f.Truncate(3*blockSize), "Truncate")
+		_, err := f.Seek(blockSize, seekData)
+		checkPathError(e.t, err, "seek", syscall.ENXIO)
+		pos, err := f.Seek(0, seekHole)
+		checkNil(e.t, err, "Seek")
+		if pos != blockSize {
+			e.t.Fatalf("Unexpected position: %v", pos)
+		}
+	})
+
+	run(t, factory, "HoleReadsZeros", func(e *env) {
+		f := sparse(e)
+		buf := make([]byte, 4)
+		_, err := f.ReadAt(buf, blockSize)
+		checkNil(e.t, err, "ReadAt")
+		if string(buf) != "\x00\x00\x00\x00" {
+			e.t.Fatalf("Unexpected read result: %q", buf)
+		}
+	})
+
+	run(t, factory, "SeekThenRead", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDONLY)
+		_, err := f.Seek(6, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		data, err := io.ReadAll(f)
+		checkNil(e.t, err, "Read")
+		if string(data) != "world" {
+			e.t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	truncates := []struct {
+		name string
+		size int64
+		want string
+	}{
+		{"Shrink", 5, "hello"},
+		{"Empty", 0, ""},
+		{"Same", 11, "hello world"},
+		{"Grow", 13, "hello world\x00\x00"},
+	}
+	for _, c := range truncates {
+		run(t, factory, "Truncate"+c.name, func(e *env) {
+			e.writeFile("file", "hello world")
+			f := e.open("file", os.O_RDWR)
+			checkNil(e.t, f.Truncate(c.size), "Truncate")
+			fi, err := f.Stat()
+			checkNil(e.t, err, "Stat")
+			if fi.Size() != c.size {
+				e.t.Fatalf("Unexpected size: %v", fi.Size())
+			}
+			e.checkFile("file", c.want)
+		})
+		run(t, factory, "FsTruncate"+c.name, func(e *env) {
+			e.writeFile("file", "hello world")
+			checkNil(e.t, e.fs.Truncate(e.path("file"), c.size), "Truncate")
+			e.checkFile("file", c.want)
+		})
+	}
+
+	run(t, factory, "TruncateNegative", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDWR)
+		checkPathError(e.t, f.Truncate(-1), "truncate", syscall.EINVAL)
+		checkPathError(e.t, e.fs.Truncate(e.path("file"), -1), "truncate", syscall.EINVAL)
+		e.checkFile("file", "hello world")
+	})
+
+	run(t, factory, "TruncateMissing", func(e *env) {
+		checkPathError(e.t, e.fs.Truncate(e.path("missing"), 0), "truncate", syscall.ENOENT)
+	})
+
+	run(t, factory, "TruncateDir", func(e *env) {
+		e.mkdir("dir")
+		checkPathError(e.t, e.fs.Truncate(e.path("dir"), 0), "truncate", syscall.EISDIR)
+	})
+
+	run(t, factory, "TruncateThroughSymlink", func(e *env) {
+		e.writeFile("file", "hello world")
+		e.symlink("file", "link")
+		checkNil(e.t, e.fs.Truncate(e.path("link"), 5), "Truncate")
+		e.checkFile("file", "hello")
+	})
+
+	run(t, factory, "Stat", func(e *env) {
+		f := e.open("file", os.O_RDWR|os.O_CREATE)
+		f.Write([]byte("hello"))
+		fi, err := f.Stat()
+		checkNil(e.t, err, "Stat")
+		if fi.Name() != "file" || fi.Size() != 5 || !fi.Mode().IsRegular() {
+			e.t.Fatalf("Unexpected info: %v %v %v", fi.Name(), fi.Size(), fi.Mode())
+		}
+	})
+
+	run(t, factory, "Sync", func(e *env) {
+		f := e.open("file", os.O_RDWR|os.O_CREATE)
+		checkNil(e.t, f.Sync(), "Sync")
+	})
+
+	run(t, factory, "ReadDir", func(e *env) {
+		e.mkdir("dir")
+		f := e.open("dir", os.O_RDONLY)
+		_, err := f.Read(make([]byte, 10))
+		checkPathError(e.t, err, "read", syscall.EISDIR)
+	})
+
+	run(t, factory, "ReaddirFile", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDONLY)
+		_, err := f.Readdir(-1)
+		checkPathError(e.t, err, "readdirent", syscall.ENOTDIR)
+	})
+
+	run(t, factory, "ReadAt", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDONLY)
+		f.Seek(2, io.SeekStart)
+		buf := make([]byte, 5)
+		n, err := f.ReadAt(buf, 6)
+		checkNil(e.t, err, "ReadAt")
+		if string(buf[:n]) != "world" {
+			e.t.Fatalf("Unexpected read result: '%v'", string(buf[:n]))
+		}
+		e.checkPosition(f, 2)
+	})
+
+	run(t, factory, "ReadAtShort", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDONLY)
+		buf := make([]byte, 10)
+		n, err := f.ReadAt(buf, 8)
+		if n != 3 || err != io.EOF || string(buf[:n]) != "rld" {
+			e.t.Fatalf("Expected a short read, got %v, '%v'", n, err)
+		}
+		n, err = f.ReadAt(buf, 20)
+		if n != 0 || err != io.EOF {
+			e.t.Fatalf("Expected EOF, got %v, '%v'", n, err)
+		}
+	})
+
+	run(t, factory, "ReadAtNegative", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDONLY)
+		_, err := f.ReadAt(make([]byte, 1), -1)
+		var pe *os.PathError
+		if !errors.As(err, &pe) || pe.Op != "readat" {
+			e.t.Fatalf("Expected readat error, got '%v'", err)
+		}
+	})
+
+	run(t, factory, "WriteAt", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDWR)
+		f.Seek(2, io.SeekStart)
+		n, err := f.WriteAt([]byte("WORLD"), 6)
+		checkNil(e.t, err, "WriteAt")
+		if n != 5 {
+			e.t.Fatalf("Unexpected write count: %v", n)
+		}
+		e.checkPosition(f, 2)
+		e.checkFile("file", "hello WORLD")
+	})
+
+	run(t, factory, "WriteAtPastEnd", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDWR)
+		_, err := f.WriteAt([]byte("world"), 8)
+		checkNil(e.t, err, "WriteAt")
+		e.checkFile("file", "hello\x00\x00\x00world")
+	})
+
+	run(t, factory, "WriteAtAfterTruncate", func(e *env) {
+		// The bytes cut off by a truncate don't come back when the file
+		// grows again.
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDWR)
+		checkNil(e.t, f.Truncate(2), "Truncate")
+		_, err := f.WriteAt([]byte("!"), 6)
+		checkNil(e.t, err, "WriteAt")
+		e.checkFile("file", "he\x00\x00\x00\x00!")
+	})
+
+	run(t, factory, "WriteAtAppend", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDWR|os.O_APPEND)
+		if _, err := f.WriteAt([]byte("world"), 0); err == nil {
+			e.t.Fatalf("Expected an error from WriteAt")
+		}
+		e.checkFile("file", "hello")
+	})
+
+	run(t, factory, "WriteAtNegative", func(e *env) {
+		e.writeFile("file", "hello")
+		f := e.open("file", os.O_RDWR)
+		_, err := f.WriteAt([]byte("world"), -1)
+		var pe *os.PathError
+		if !errors.As(err, &pe) || pe.Op != "writeat" {
+			e.t.Fatalf("Expected writeat error, got '%v'", err)
+		}
+	})
+
+	run(t, factory, "CopyFrom", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDONLY)
+		f.Seek(6, io.SeekStart)
+		var buf strings.Builder
+		n, err := io.Copy(&buf, f)
+		checkNil(e.t, err, "Copy")
+		if n != 5 || buf.String() != "world" {
+			e.t.Fatalf("Unexpected copy result: %v, '%v'", n, buf.String())
+		}
+		e.checkPosition(f, 11)
+	})
+
+	run(t, factory, "CopyTo", func(e *env) {
+		e.writeFile("file", "hello world")
+		f := e.open("file", os.O_RDWR)
+		f.Seek(6, io.SeekStart)
+		n, err := io.Copy(f, strings.NewReader("there, world"))
+		checkNil(e.t, err, "Copy")
+		if n != 12 {
+			e.t.Fatalf("Unexpected copy count: %v", n)
+		}
+		e.checkPosition(f, 18)
+		e.checkFile("file", "hello there, world")
+	})
+
+	run(t, factory, "CopyBetween", func(e *env) {
+		e.writeFile("src", "hello world")
+		src := e.open("src", os.O_RDONLY)
+		dst := e.open("dst", os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+		dst.Write([]byte("> "))
+		_, err := io.Copy(dst, src)
+		checkNil(e.t, err, "Copy")
+		e.checkFile("dst", "> hello world")
+	})
+
+	modes := []struct {
+		name string
+		path string
+		flag int
+		op   string
+		want error
+		f    func(f gofs.File) error
+	}{
+		{"WriteReadOnly", "file", os.O_RDONLY, "write", syscall.EBADF, func(f gofs.File) error { _, err := f.Write([]byte("x")); return err }},
+		{"WriteAtReadOnly", "file", os.O_RDONLY, "write", syscall.EBADF, func(f gofs.File) error { _, err := f.WriteAt([]byte("x"), 0); return err }},
+		{"CopyToReadOnly", "file", os.O_RDONLY, "write", syscall.EBADF, func(f gofs.File) error { _, err := io.Copy(f, strings.NewReader("x")); return err }},
+		{"TruncateReadOnly", "file", os.O_RDONLY, "truncate", syscall.EINVAL, func(f gofs.File) error { return f.Truncate(0) }},
+		{"TruncateDirHandle", "dir", os.O_RDONLY, "truncate", syscall.EINVAL, func(f gofs.File) error { return f.Truncate(0) }},
+		{"ReadWriteOnly", "file", os.O_WRONLY, "read", syscall.EBADF, func(f gofs.File) error { _, err := f.Read(make([]byte, 1)); return err }},
+		{"ReadAtWriteOnly", "file", os.O_WRONLY, "read", syscall.EBADF, func(f gofs.File) error { _, err := f.ReadAt(make([]byte, 1), 0); return err }},
+		{"CopyFromWriteOnly", "file", os.O_WRONLY, "read", syscall.EBADF, func(f gofs.File) error { _, err := io.Copy(io.Discard, f); return err }},
+		{"WriteDir", "dir", os.O_RDONLY, "write", syscall.EBADF, func(f gofs.File) error { _, err := f.Write([]byte("x")); return err }},
+		{"ReadAtDir", "dir", os.O_RDONLY, "read", syscall.EISDIR, func(f gofs.File) error { _, err := f.ReadAt(make([]byte, 1), 0); return err }},
+		{"CopyFromDir", "dir", os.O_RDONLY, "read", syscall.EISDIR, func(f gofs.File) error { _, err := io.Copy(io.Discard, f); return err }},
+	}
+	for _, c := range modes {
+		run(t, factory, c.name, func(e *env) {
+			e.writeFile("file", "hello")
+			e.mkdir("dir")
+			f := e.open(c.path, c.flag)
+			checkPathError(e.t, c.f(f), c.op, c.want)
+			if c.path == "file" {
+				e.checkFile("file", "hello")
+			}
+		})
+	}
+
+	run(t, factory, "ReadWriteModes", func(e *env) {
+		e.writeFile("file", "hello")
+		r := e.open("file", os.O_RDONLY)
+		w := e.open("file", os.O_WRONLY)
+		rw := e.open("file", os.O_RDWR)
+		for _, f := range []gofs.File{r, rw} {
+			_, err := f.Read(make([]byte, 1))
+			checkNil(e.t, err, "Read")
+		}
+		for _, f := range []gofs.File{w, rw} {
+			_, err := f.Write([]byte("x"))
+			checkNil(e.t, err, "Write")
+			checkNil(e.t, f.Truncate(3), "Truncate")
+		}
+		// Metadata can be changed through any handle.
+		for _, f := range []gofs.File{r, w} {
+			checkNil(e.t, f.Chmod(os.FileMode(0600)), "Chmod")
+			checkNil(e.t, f.Sync(), "Sync")
+		}
+	})
+
+	closed := []struct {
+		name string
+		op   string
+		f    func(f gofs.File) error
+	}{
+		{"Read", "read", func(f gofs.File) error { _, err := f.Read(make([]byte, 1)); return err }},
+		{"ReadAt", "read", func(f gofs.File) error { _, err := f.ReadAt(make([]byte, 1), 0); return err }},
+		{"WriteAt", "write", func(f gofs.File) error { _, err := f.WriteAt([]byte("x"), 0); return err }},
+		{"Write", "write", func(f gofs.File) error { _, err := f.Write([]byte("x")); return err }},
+		{"Seek", "seek", func(f gofs.File) error { _, err := f.Seek(0, io.SeekStart); return err }},
+		{"Stat", "stat", func(f gofs.File) error { _, err := f.Stat(); return err }},
+		{"Truncate", "truncate", func(f gofs.File) error { return f.Truncate(0) }},
+		{"Sync", "sync", func(f gofs.File) error { return f.Sync() }},
+		{"Chmod", "chmod", func(f gofs.File) error { return f.Chmod(0600) }},
+		{"Close", "close", func(f gofs.File) error { return f.Close() }},
+	}
+	for _, c := range closed {
+		run(t, factory, "Closed"+c.name, func(e *env) {
+			f, err := e.fs.OpenFile(e.path("file"), os.O_RDWR|os.O_CREATE, os.FileMode(0644))
+			checkNil(e.t, err, "OpenFile")
+			checkNil(e.t, f.Close(), "Close")
+			checkPathError(e.t, c.f(f), c.op, os.ErrClosed)
+		})
+	}
+}
+
+// checkPosition checks the offset that f will next read from.
+func (e *env) checkPosition(f gofs.File, want int64) {
+	e.t.Helper()
+	pos, err := f.Seek(0, io.SeekCurrent)
+	checkNil(e.t, err, "Seek")
+	if pos != want {
+		e.t.Fatalf("Unexpected position: %v", pos)
+	}
+}
@@ -0,0 +1,147 @@
+// Package fstest checks that a gofs.FileSystem behaves like the os package
+// does on Linux.
+package fstest
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/fernomac/gofs"
+)
+
+// Factory returns a FileSystem to test, along with the absolute path of an
+// empty directory in it that the tests are free to fill. It's called once per
+// test, so each one starts from scratch.
+type Factory func(t *testing.T) (gofs.FileSystem, string)
+
+// TestFileSystem runs the conformance tests against the file systems made by
+// factory, reporting any behaviour that differs from os as a test failure.
+//
+// Some of the tests change the current directory, so they must not run in
+// parallel with anything else that depends on it.
+func TestFileSystem(t *testing.T, factory Factory) {
+	t.Run("Open", func(t *testing.T) { testOpen(t, factory) })
+	t.Run("File", func(t *testing.T) { testFile(t, factory) })
+	t.Run("Dir", func(t *testing.T) { testDir(t, factory) })
+	t.Run("Rename", func(t *testing.T) { testRename(t, factory) })
+	t.Run("Symlink", func(t *testing.T) { testSymlink(t, factory) })
+	t.Run("Link", func(t *testing.T) { testLink(t, factory) })
+	t.Run("Metadata", func(t *testing.T) { testMetadata(t, factory) })
+}
+
+// env is a FileSystem under test, with helpers that fail the test if setting
+// it up goes wrong.
+type env struct {
+	t    *testing.T
+	fs   gofs.FileSystem
+	root string
+}
+
+// run runs f as a subtest against a fresh FileSystem.
+func run(t *testing.T, factory Factory, name string, f func(e *env)) {
+	t.Run(name, func(t *testing.T) {
+		fs, root := factory(t)
+		f(&env{t: t, fs: fs, root: root})
+	})
+}
+
+// path returns the absolute path of name in the test directory.
+func (e *env) path(name string) string {
+	if name == "" {
+		return e.root
+	}
+	return e.root + "/" + name
+}
+
+func (e *env) mkdir(name string) {
+	e.t.Helper()
+	if err := e.fs.MkdirAll(e.path(name), os.FileMode(0755)); err != nil {
+		e.t.Fatalf("Unexpected error from MkdirAll: %v", err)
+	}
+}
+
+func (e *env) writeFile(name string, data string) {
+	e.t.Helper()
+	if err := gofs.WriteFile(e.fs, e.path(name), []byte(data), os.FileMode(0644)); err != nil {
+		e.t.Fatalf("Unexpected error from WriteFile: %v", err)
+	}
+}
+
+func (e *env) symlink(target, name string) {
+	e.t.Helper()
+	if err := e.fs.Symlink(target, e.path(name)); err != nil {
+		e.t.Fatalf("Unexpected error from Symlink: %v", err)
+	}
+}
+
+func (e *env) open(name string, flag int) gofs.File {
+	e.t.Helper()
+	f, err := e.fs.OpenFile(e.path(name), flag, os.FileMode(0644))
+	if err != nil {
+		e.t.Fatalf("Unexpected error from OpenFile: %v", err)
+	}
+	e.t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func (e *env) readFile(name string) string {
+	e.t.Helper()
+	data, err := gofs.ReadFile(e.fs, e.path(name))
+	if err != nil {
+		e.t.Fatalf("Unexpected error from ReadFile: %v", err)
+	}
+	return string(data)
+}
+
+// checkFile checks that name is a regular file holding data.
+func (e *env) checkFile(name string, data string) {
+	e.t.Helper()
+	if got := e.readFile(name); got != data {
+		e.t.Fatalf("Unexpected contents of %v: '%v'", name, got)
+	}
+}
+
+// checkMissing checks that nothing exists at name.
+func (e *env) checkMissing(name string) {
+	e.t.Helper()
+	_, err := e.fs.Lstat(e.path(name))
+	checkPathError(e.t, err, "lstat", os.ErrNotExist)
+}
+
+// checkType checks that Lstat of name reports the given file type.
+func (e *env) checkType(name string, typ os.FileMode) {
+	e.t.Helper()
+	fi, err := e.fs.Lstat(e.path(name))
+	if err != nil {
+		e.t.Fatalf("Unexpected error from Lstat: %v", err)
+	}
+	if fi.Mode()&os.ModeType != typ {
+		e.t.Fatalf("Unexpected type of %v: %v", name, fi.Mode())
+	}
+}
+
+func checkNil(t *testing.T, err error, what string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Unexpected error from %v: %v", what, err)
+	}
+}
+
+// checkPathError checks that err is an *os.PathError from op wrapping want.
+func checkPathError(t *testing.T, err error, op string, want error) {
+	t.Helper()
+	var pe *os.PathError
+	if !errors.As(err, &pe) || pe.Op != op || !errors.Is(pe.Err, want) {
+		t.Fatalf("Expected %v error wrapping '%v', got '%v'", op, want, err)
+	}
+}
+
+// checkLinkError checks that err is an *os.LinkError from op wrapping want.
+func checkLinkError(t *testing.T, err error, op string, want error) {
+	t.Helper()
+	var le *os.LinkError
+	if !errors.As(err, &le) || le.Op != op || !errors.Is(le.Err, want) {
+		t.Fatalf("Expected %v error wrapping '%v', got '%v'", op, want, err)
+	}
+}
@@ -0,0 +1,62 @@
+package fstest
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/fernomac/gofs"
+)
+
+func TestMockFs(t *testing.T) {
+	TestFileSystem(t, func(t *testing.T) (gofs.FileSystem, string) {
+		fs := gofs.MockFs()
+		if err := fs.MkdirAll("/tmp/test", os.FileMode(0755)); err != nil {
+			t.Fatalf("Unexpected error from MkdirAll: %v", err)
+		}
+		return fs, "/tmp/test"
+	})
+}
+
+func TestOsFs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("The conformance tests expect Linux behaviour")
+	}
+	TestFileSystem(t, func(t *testing.T) (gofs.FileSystem, string) {
+		return gofs.OsFs(), t.TempDir()
+	})
+}
+
+func TestOverlay(t *testing.T) {
+	TestFileSystem(t, func(t *testing.T) (gofs.FileSystem, string) {
+		lower := gofs.MockFs()
+		if err := lower.MkdirAll("/tmp/test", os.FileMode(0755)); err != nil {
+			t.Fatalf("Unexpected error from MkdirAll: %v", err)
+		}
+		return gofs.Overlay(lower, gofs.MockFs()), "/tmp/test"
+	})
+}
+
+func TestBasePath(t *testing.T) {
+	TestFileSystem(t, func(t *testing.T) (gofs.FileSystem, string) {
+		fs := gofs.MockFs()
+		if err := fs.MkdirAll("/sandbox/tmp/test", os.FileMode(0755)); err != nil {
+			t.Fatalf("Unexpected error from MkdirAll: %v", err)
+		}
+		return gofs.BasePath(fs, "/sandbox"), "/tmp/test"
+	})
+}
+
+func TestMountFs(t *testing.T) {
+	TestFileSystem(t, func(t *testing.T) (gofs.FileSystem, string) {
+		root := gofs.MockFs()
+		if err := root.MkdirAll("/tmp", os.FileMode(0755)); err != nil {
+			t.Fatalf("Unexpected error from MkdirAll: %v", err)
+		}
+		fs := gofs.MountFs(root)
+		if err := fs.Mount("/tmp/test", gofs.MockFs()); err != nil {
+			t.Fatalf("Unexpected error from Mount: %v", err)
+		}
+		return fs, "/tmp/test"
+	})
+}
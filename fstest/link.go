@@ -0,0 +1,71 @@
+package fstest
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func testLink(t *testing.T, factory Factory) {
+	run(t, factory, "Shared", func(e *env) {
+		e.writeFile("a", "hello")
+		checkNil(e.t, e.fs.Link(e.path("a"), e.path("b")), "Link")
+		e.checkFile("b", "hello")
+		e.writeFile("b", "changed")
+		e.checkFile("a", "changed")
+	})
+
+	run(t, factory, "RemoveOne", func(e *env) {
+		e.writeFile("a", "hello")
+		checkNil(e.t, e.fs.Link(e.path("a"), e.path("b")), "Link")
+		checkNil(e.t, e.fs.Remove(e.path("a")), "Remove")
+		e.checkMissing("a")
+		e.checkFile("b", "hello")
+	})
+
+	run(t, factory, "Symlink", func(e *env) {
+		// Link doesn't follow a symlink; it links the symlink itself.
+		e.writeFile("file", "hello")
+		e.symlink("file", "link")
+		checkNil(e.t, e.fs.Link(e.path("link"), e.path("hard")), "Link")
+		e.checkType("hard", os.ModeSymlink)
+		e.checkFile("hard", "hello")
+	})
+
+	run(t, factory, "Dangling", func(e *env) {
+		e.symlink("missing", "link")
+		checkNil(e.t, e.fs.Link(e.path("link"), e.path("hard")), "Link")
+		e.checkType("hard", os.ModeSymlink)
+	})
+
+	run(t, factory, "OtherDir", func(e *env) {
+		e.writeFile("file", "hello")
+		e.mkdir("dir")
+		checkNil(e.t, e.fs.Link(e.path("file"), e.path("dir/file")), "Link")
+		e.checkFile("dir/file", "hello")
+	})
+
+	cases := []struct {
+		name string
+		old  string
+		new  string
+		want error
+	}{
+		{"Dir", "dir", "new", syscall.EPERM},
+		{"Missing", "missing", "new", syscall.ENOENT},
+		{"ExistingFile", "file", "other", syscall.EEXIST},
+		{"ExistingDir", "file", "dir", syscall.EEXIST},
+		{"Itself", "file", "file", syscall.EEXIST},
+		{"MissingParent", "file", "missing/new", syscall.ENOENT},
+		{"FileParent", "file", "file/new", syscall.ENOTDIR},
+	}
+	for _, c := range cases {
+		run(t, factory, c.name, func(e *env) {
+			e.writeFile("file", "hello")
+			e.writeFile("other", "goodbye")
+			e.mkdir("dir")
+			err := e.fs.Link(e.path(c.old), e.path(c.new))
+			checkLinkError(e.t, err, "link", c.want)
+		})
+	}
+}
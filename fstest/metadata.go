@@ -0,0 +1,225 @@
+package fstest
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testMetadata(t *testing.T, factory Factory) {
+	run(t, factory, "Stat", func(e *env) {
+		e.writeFile("file", "hello")
+		fi, err := e.fs.Stat(e.path("file"))
+		checkNil(e.t, err, "Stat")
+		if fi.Name() != "file" || fi.Size() != 5 || fi.Mode() != os.FileMode(0644) || fi.IsDir() {
+			e.t.Fatalf("Unexpected info: %v %v %v", fi.Name(), fi.Size(), fi.Mode())
+		}
+	})
+
+	run(t, factory, "StatDir", func(e *env) {
+		e.mkdir("dir")
+		fi, err := e.fs.Stat(e.path("dir"))
+		checkNil(e.t, err, "Stat")
+		if fi.Name() != "dir" || !fi.IsDir() || fi.Mode() != os.ModeDir|os.FileMode(0755) {
+			e.t.Fatalf("Unexpected info: %v %v", fi.Name(), fi.Mode())
+		}
+	})
+
+	run(t, factory, "StatTrailingSlash", func(e *env) {
+		e.mkdir("dir")
+		fi, err := e.fs.Stat(e.path("dir/"))
+		checkNil(e.t, err, "Stat")
+		if !fi.IsDir() {
+			e.t.Fatalf("Unexpected mode: %v", fi.Mode())
+		}
+	})
+
+	run(t, factory, "StatDotDot", func(e *env) {
+		e.mkdir("a/b")
+		e.writeFile("file", "hello")
+		fi, err := e.fs.Stat(e.path("a/b/../../file"))
+		checkNil(e.t, err, "Stat")
+		if fi.Size() != 5 {
+			e.t.Fatalf("Unexpected size: %v", fi.Size())
+		}
+	})
+
+	statErrors := []struct {
+		name string
+		path string
+		want error
+	}{
+		{"Missing", "missing", syscall.ENOENT},
+		{"MissingParent", "missing/file", syscall.ENOENT},
+		{"FileParent", "file/x", syscall.ENOTDIR},
+		{"FileDotDot", "file/..", syscall.ENOTDIR},
+	}
+	for _, c := range statErrors {
+		run(t, factory, "Stat"+c.name, func(e *env) {
+			e.writeFile("file", "hello")
+			_, err := e.fs.Stat(e.path(c.path))
+			checkPathError(e.t, err, "stat", c.want)
+			_, err = e.fs.Lstat(e.path(c.path))
+			checkPathError(e.t, err, "lstat", c.want)
+		})
+	}
+
+	run(t, factory, "Chmod", func(e *env) {
+		e.writeFile("file", "hello")
+		checkNil(e.t, e.fs.Chmod(e.path("file"), os.FileMode(0600)), "Chmod")
+		fi, err := e.fs.Stat(e.path("file"))
+		checkNil(e.t, err, "Stat")
+		if fi.Mode() != os.FileMode(0600) {
+			e.t.Fatalf("Unexpected mode: %v", fi.Mode())
+		}
+	})
+
+	run(t, factory, "ChmodDir", func(e *env) {
+		e.mkdir("dir")
+		checkNil(e.t, e.fs.Chmod(e.path("dir"), os.FileMode(0700)), "Chmod")
+		fi, err := e.fs.Stat(e.path("dir"))
+		checkNil(e.t, err, "Stat")
+		if fi.Mode() != os.ModeDir|os.FileMode(0700) {
+			e.t.Fatalf("Unexpected mode: %v", fi.Mode())
+		}
+	})
+
+	run(t, factory, "ChmodFile", func(e *env) {
+		f := e.open("file", os.O_RDWR|os.O_CREATE)
+		checkNil(e.t, f.Chmod(os.FileMode(0600)), "Chmod")
+		fi, err := f.Stat()
+		checkNil(e.t, err, "Stat")
+		if fi.Mode() != os.FileMode(0600) {
+			e.t.Fatalf("Unexpected mode: %v", fi.Mode())
+		}
+	})
+
+	run(t, factory, "ChmodMissing", func(e *env) {
+		err := e.fs.Chmod(e.path("missing"), os.FileMode(0600))
+		checkPathError(e.t, err, "chmod", syscall.ENOENT)
+	})
+
+	run(t, factory, "Chtimes", func(e *env) {
+		e.writeFile("file", "hello")
+		mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+		atime := mtime.Add(time.Hour)
+		checkNil(e.t, e.fs.Chtimes(e.path("file"), atime, mtime), "Chtimes")
+		fi, err := e.fs.Stat(e.path("file"))
+		checkNil(e.t, err, "Stat")
+		if !fi.ModTime().Equal(mtime) {
+			e.t.Fatalf("Unexpected modification time: %v", fi.ModTime())
+		}
+	})
+
+	run(t, factory, "ChtimesZero", func(e *env) {
+		e.writeFile("file", "hello")
+		mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+		checkNil(e.t, e.fs.Chtimes(e.path("file"), mtime, mtime), "Chtimes")
+		checkNil(e.t, e.fs.Chtimes(e.path("file"), time.Time{}, time.Time{}), "Chtimes")
+		fi, err := e.fs.Stat(e.path("file"))
+		checkNil(e.t, err, "Stat")
+		if !fi.ModTime().Equal(mtime) {
+			e.t.Fatalf("Unexpected modification time: %v", fi.ModTime())
+		}
+	})
+
+	run(t, factory, "ChtimesMissing", func(e *env) {
+		now := time.Now()
+		err := e.fs.Chtimes(e.path("missing"), now, now)
+		checkPathError(e.t, err, "chtimes", syscall.ENOENT)
+	})
+
+	run(t, factory, "WriteUpdatesModTime", func(e *env) {
+		e.writeFile("file", "hello")
+		old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+		checkNil(e.t, e.fs.Chtimes(e.path("file"), old, old), "Chtimes")
+		e.writeFile("file", "changed")
+		fi, err := e.fs.Stat(e.path("file"))
+		checkNil(e.t, err, "Stat")
+		if !fi.ModTime().After(old) {
+			e.t.Fatalf("Unexpected modification time: %v", fi.ModTime())
+		}
+	})
+
+	run(t, factory, "Chdir", func(e *env) {
+		e.mkdir("dir")
+		e.writeFile("dir/file", "hello")
+		e.chdir("dir")
+
+		wd, err := e.fs.Getwd()
+		checkNil(e.t, err, "Getwd")
+		if wd != e.path("dir") {
+			e.t.Fatalf("Unexpected working directory: '%v'", wd)
+		}
+		abs, err := e.fs.Abs("file")
+		checkNil(e.t, err, "Abs")
+		if abs != e.path("dir/file") {
+			e.t.Fatalf("Unexpected absolute path: '%v'", abs)
+		}
+		data, err := e.readRelative("file")
+		checkNil(e.t, err, "ReadFile")
+		if data != "hello" {
+			e.t.Fatalf("Unexpected read result: '%v'", data)
+		}
+		data, err = e.readRelative("../dir/./file")
+		checkNil(e.t, err, "ReadFile")
+		if data != "hello" {
+			e.t.Fatalf("Unexpected read result: '%v'", data)
+		}
+	})
+
+	run(t, factory, "ChdirSymlink", func(e *env) {
+		e.mkdir("a/dir")
+		e.writeFile("a/file", "hello")
+		e.symlink("a/dir", "link")
+		e.chdir("link")
+
+		// ".." is the parent of the directory the link led to.
+		data, err := e.readRelative("../file")
+		checkNil(e.t, err, "ReadFile")
+		if data != "hello" {
+			e.t.Fatalf("Unexpected read result: '%v'", data)
+		}
+	})
+
+	chdirErrors := []struct {
+		name string
+		path string
+		want error
+	}{
+		{"File", "file", syscall.ENOTDIR},
+		{"Missing", "missing", syscall.ENOENT},
+	}
+	for _, c := range chdirErrors {
+		run(t, factory, "Chdir"+c.name, func(e *env) {
+			e.writeFile("file", "hello")
+			checkPathError(e.t, e.fs.Chdir(e.path(c.path)), "chdir", c.want)
+		})
+	}
+}
+
+// chdir changes to the directory name for the rest of the test.
+func (e *env) chdir(name string) {
+	e.t.Helper()
+	wd, err := e.fs.Getwd()
+	checkNil(e.t, err, "Getwd")
+	checkNil(e.t, e.fs.Chdir(e.path(name)), "Chdir")
+	e.t.Cleanup(func() { e.fs.Chdir(wd) })
+}
+
+// readRelative reads the file at a path relative to the current directory.
+func (e *env) readRelative(path string) (string, error) {
+	f, err := e.fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, fi.Size())
+	n, err := f.Read(buf)
+	return string(buf[:n]), err
+}
@@ -0,0 +1,172 @@
+package fstest
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// The things that can be found at a path being opened.
+var openTargets = []string{"missing", "file", "dir", "link", "dangling"}
+
+// openCases gives the result of opening each of openTargets with a flag, nil
+// meaning success.
+var openCases = []struct {
+	name string
+	flag int
+	want [5]error
+}{
+	{"RDONLY", os.O_RDONLY, [5]error{syscall.ENOENT, nil, nil, nil, syscall.ENOENT}},
+	{"WRONLY", os.O_WRONLY, [5]error{syscall.ENOENT, nil, syscall.EISDIR, nil, syscall.ENOENT}},
+	{"RDWR", os.O_RDWR, [5]error{syscall.ENOENT, nil, syscall.EISDIR, nil, syscall.ENOENT}},
+	{"RDONLY|CREATE", os.O_RDONLY | os.O_CREATE, [5]error{nil, nil, syscall.EISDIR, nil, nil}},
+	{"WRONLY|CREATE", os.O_WRONLY | os.O_CREATE, [5]error{nil, nil, syscall.EISDIR, nil, nil}},
+	{"RDWR|CREATE", os.O_RDWR | os.O_CREATE, [5]error{nil, nil, syscall.EISDIR, nil, nil}},
+	{"WRONLY|CREATE|EXCL", os.O_WRONLY | os.O_CREATE | os.O_EXCL, [5]error{nil, syscall.EEXIST, syscall.EEXIST, syscall.EEXIST, syscall.EEXIST}},
+	{"RDWR|CREATE|EXCL", os.O_RDWR | os.O_CREATE | os.O_EXCL, [5]error{nil, syscall.EEXIST, syscall.EEXIST, syscall.EEXIST, syscall.EEXIST}},
+	{"WRONLY|TRUNC", os.O_WRONLY | os.O_TRUNC, [5]error{syscall.ENOENT, nil, syscall.EISDIR, nil, syscall.ENOENT}},
+	{"RDWR|TRUNC", os.O_RDWR | os.O_TRUNC, [5]error{syscall.ENOENT, nil, syscall.EISDIR, nil, syscall.ENOENT}},
+	{"WRONLY|CREATE|TRUNC", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, [5]error{nil, nil, syscall.EISDIR, nil, nil}},
+	{"WRONLY|APPEND", os.O_WRONLY | os.O_APPEND, [5]error{syscall.ENOENT, nil, syscall.EISDIR, nil, syscall.ENOENT}},
+	{"RDWR|APPEND", os.O_RDWR | os.O_APPEND, [5]error{syscall.ENOENT, nil, syscall.EISDIR, nil, syscall.ENOENT}},
+	{"WRONLY|CREATE|APPEND", os.O_WRONLY | os.O_CREATE | os.O_APPEND, [5]error{nil, nil, syscall.EISDIR, nil, nil}},
+}
+
+func testOpen(t *testing.T, factory Factory) {
+	for _, c := range openCases {
+		for i, target := range openTargets {
+			want := c.want[i]
+			run(t, factory, c.name+"/"+target, func(e *env) {
+				e.writeFile("file", "contents")
+				e.mkdir("dir")
+				e.symlink("file", "link")
+				e.symlink("target", "dangling")
+
+				f, err := e.fs.OpenFile(e.path(target), c.flag, os.FileMode(0644))
+				if want != nil {
+					if err == nil {
+						f.Close()
+					}
+					checkPathError(e.t, err, "open", want)
+					return
+				}
+				checkNil(e.t, err, "OpenFile")
+				checkNil(e.t, f.Close(), "Close")
+
+				switch {
+				case target == "missing":
+					e.checkFile("missing", "")
+				case target == "dangling":
+					// The file is created where the link points.
+					e.checkType("dangling", os.ModeSymlink)
+					e.checkFile("target", "")
+				case target != "dir" && c.flag&os.O_TRUNC != 0:
+					e.checkFile("file", "")
+				case target != "dir":
+					e.checkFile("file", "contents")
+				}
+			})
+		}
+	}
+
+	run(t, factory, "CreatePerm", func(e *env) {
+		f, err := e.fs.OpenFile(e.path("file"), os.O_WRONLY|os.O_CREATE, os.FileMode(0600))
+		checkNil(e.t, err, "OpenFile")
+		f.Close()
+		fi, err := e.fs.Stat(e.path("file"))
+		checkNil(e.t, err, "Stat")
+		if fi.Mode() != os.FileMode(0600) {
+			e.t.Fatalf("Unexpected mode: %v", fi.Mode())
+		}
+	})
+
+	run(t, factory, "CreateTruncates", func(e *env) {
+		e.writeFile("file", "contents")
+		f, err := e.fs.Create(e.path("file"))
+		checkNil(e.t, err, "Create")
+		f.Close()
+		e.checkFile("file", "")
+	})
+
+	run(t, factory, "CreateInMissingDir", func(e *env) {
+		_, err := e.fs.Create(e.path("missing/file"))
+		checkPathError(e.t, err, "open", syscall.ENOENT)
+	})
+
+	run(t, factory, "CreateInFile", func(e *env) {
+		e.writeFile("file", "contents")
+		_, err := e.fs.Create(e.path("file/file"))
+		checkPathError(e.t, err, "open", syscall.ENOTDIR)
+	})
+
+	run(t, factory, "CreateTrailingSlash", func(e *env) {
+		_, err := e.fs.OpenFile(e.path("new/"), os.O_WRONLY|os.O_CREATE, os.FileMode(0644))
+		checkPathError(e.t, err, "open", syscall.EISDIR)
+		e.checkMissing("new")
+	})
+
+	run(t, factory, "FileTrailingSlash", func(e *env) {
+		e.writeFile("file", "contents")
+		_, err := e.fs.Open(e.path("file/"))
+		checkPathError(e.t, err, "open", syscall.ENOTDIR)
+	})
+
+	run(t, factory, "DirTrailingSlash", func(e *env) {
+		e.mkdir("dir")
+		f, err := e.fs.Open(e.path("dir/"))
+		checkNil(e.t, err, "Open")
+		f.Close()
+	})
+
+	run(t, factory, "Name", func(e *env) {
+		e.writeFile("file", "contents")
+		f := e.open("file", os.O_RDONLY)
+		if f.Name() != e.path("file") {
+			e.t.Fatalf("Unexpected name: '%v'", f.Name())
+		}
+	})
+
+	run(t, factory, "Append", func(e *env) {
+		e.writeFile("file", "one")
+		f := e.open("file", os.O_WRONLY|os.O_APPEND)
+		_, err := f.Write([]byte("two"))
+		checkNil(e.t, err, "Write")
+		_, err = f.Write([]byte("three"))
+		checkNil(e.t, err, "Write")
+		e.checkFile("file", "onetwothree")
+	})
+
+	run(t, factory, "AppendAfterSeek", func(e *env) {
+		e.writeFile("file", "one")
+		f := e.open("file", os.O_RDWR|os.O_APPEND)
+		_, err := f.Seek(0, io.SeekStart)
+		checkNil(e.t, err, "Seek")
+		_, err = f.Write([]byte("two"))
+		checkNil(e.t, err, "Write")
+		e.checkFile("file", "onetwo")
+	})
+
+	run(t, factory, "AppendReadsFromStart", func(e *env) {
+		e.writeFile("file", "one")
+		f := e.open("file", os.O_RDWR|os.O_APPEND)
+		data, err := io.ReadAll(f)
+		checkNil(e.t, err, "Read")
+		if string(data) != "one" {
+			e.t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	run(t, factory, "SharedContents", func(e *env) {
+		e.writeFile("file", "")
+		w := e.open("file", os.O_WRONLY)
+		r := e.open("file", os.O_RDONLY)
+		_, err := w.Write([]byte("hello"))
+		checkNil(e.t, err, "Write")
+		data, err := io.ReadAll(r)
+		checkNil(e.t, err, "Read")
+		if string(data) != "hello" {
+			e.t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+}
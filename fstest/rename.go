@@ -0,0 +1,134 @@
+package fstest
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func testRename(t *testing.T, factory Factory) {
+	run(t, factory, "File", func(e *env) {
+		e.writeFile("old", "hello")
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("new")), "Rename")
+		e.checkMissing("old")
+		e.checkFile("new", "hello")
+	})
+
+	run(t, factory, "OverFile", func(e *env) {
+		e.writeFile("old", "hello")
+		e.writeFile("new", "goodbye")
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("new")), "Rename")
+		e.checkMissing("old")
+		e.checkFile("new", "hello")
+	})
+
+	run(t, factory, "OverSymlink", func(e *env) {
+		e.writeFile("old", "hello")
+		e.writeFile("file", "goodbye")
+		e.symlink("file", "link")
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("link")), "Rename")
+		e.checkType("link", 0)
+		e.checkFile("link", "hello")
+		e.checkFile("file", "goodbye")
+	})
+
+	run(t, factory, "IntoDir", func(e *env) {
+		e.writeFile("old", "hello")
+		e.mkdir("dir")
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("dir/new")), "Rename")
+		e.checkFile("dir/new", "hello")
+	})
+
+	run(t, factory, "Dir", func(e *env) {
+		e.mkdir("old/sub")
+		e.writeFile("old/sub/file", "hello")
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("new")), "Rename")
+		e.checkMissing("old")
+		e.checkFile("new/sub/file", "hello")
+	})
+
+	run(t, factory, "DirIntoSibling", func(e *env) {
+		e.mkdir("a/sub")
+		e.mkdir("b")
+		checkNil(e.t, e.fs.Rename(e.path("a/sub"), e.path("b/sub")), "Rename")
+		e.checkType("b/sub", os.ModeDir)
+		// ".." now leads to the new parent.
+		e.writeFile("b/sub/../file", "hello")
+		e.checkFile("b/file", "hello")
+	})
+
+	run(t, factory, "Symlink", func(e *env) {
+		e.writeFile("file", "hello")
+		e.symlink("file", "old")
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("new")), "Rename")
+		e.checkType("new", os.ModeSymlink)
+		e.checkFile("new", "hello")
+		e.checkFile("file", "hello")
+	})
+
+	run(t, factory, "Itself", func(e *env) {
+		e.writeFile("file", "hello")
+		checkNil(e.t, e.fs.Rename(e.path("file"), e.path("file")), "Rename")
+		e.checkFile("file", "hello")
+	})
+
+	run(t, factory, "HardLinks", func(e *env) {
+		// Renaming between two links to the same file does nothing.
+		e.writeFile("a", "hello")
+		checkNil(e.t, e.fs.Link(e.path("a"), e.path("b")), "Link")
+		checkNil(e.t, e.fs.Rename(e.path("a"), e.path("b")), "Rename")
+		e.checkFile("a", "hello")
+		e.checkFile("b", "hello")
+	})
+
+	run(t, factory, "OpenFile", func(e *env) {
+		e.writeFile("old", "hello")
+		f := e.open("old", os.O_RDONLY)
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("new")), "Rename")
+		data, err := io.ReadAll(f)
+		checkNil(e.t, err, "Read")
+		if string(data) != "hello" {
+			e.t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	run(t, factory, "OverOpenFile", func(e *env) {
+		e.writeFile("old", "hello")
+		e.writeFile("new", "goodbye")
+		f := e.open("new", os.O_RDONLY)
+		checkNil(e.t, e.fs.Rename(e.path("old"), e.path("new")), "Rename")
+		data, err := io.ReadAll(f)
+		checkNil(e.t, err, "Read")
+		if string(data) != "goodbye" {
+			e.t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	cases := []struct {
+		name string
+		old  string
+		new  string
+		want error
+	}{
+		{"Missing", "missing", "new", syscall.ENOENT},
+		{"MissingParent", "file", "missing/new", syscall.ENOENT},
+		{"FileParent", "file", "file/new", syscall.ENOTDIR},
+		{"FileOverDir", "file", "empty", syscall.EEXIST},
+		{"FileOverFullDir", "file", "dir", syscall.EEXIST},
+		{"DirOverEmptyDir", "dir", "empty", syscall.EEXIST},
+		{"DirOverFile", "dir", "file", syscall.ENOTDIR},
+		{"DirOverItself", "dir", "dir", syscall.EEXIST},
+		{"DirIntoItself", "dir", "dir/new", syscall.EINVAL},
+		{"DirIntoChild", "dir", "dir/sub/new", syscall.EINVAL},
+	}
+	for _, c := range cases {
+		run(t, factory, c.name, func(e *env) {
+			e.writeFile("file", "hello")
+			e.mkdir("dir/sub")
+			e.mkdir("empty")
+			err := e.fs.Rename(e.path(c.old), e.path(c.new))
+			checkLinkError(e.t, err, "rename", c.want)
+		})
+	}
+}
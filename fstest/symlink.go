@@ -0,0 +1,206 @@
+package fstest
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func testSymlink(t *testing.T, factory Factory) {
+	// setup makes a small tree full of links, including some broken ones.
+	setup := func(e *env) {
+		e.mkdir("a/b/c")
+		e.writeFile("a/b/c/file", "c")
+		e.writeFile("a/b/file", "b")
+		e.writeFile("a/file", "a")
+		e.writeFile("file", "root")
+		e.mkdir("links")
+		e.symlink("../a/b/c", "links/rel")
+		e.symlink(e.path("a/b/c"), "links/abs")
+		e.symlink("rel", "links/chain")
+		e.symlink("loop2", "links/loop1")
+		e.symlink("loop1", "links/loop2")
+		e.symlink("self", "links/self")
+		e.symlink("missing", "links/dangling")
+		e.symlink("../file", "links/file")
+		e.symlink("../file/x", "links/throughfile")
+		e.symlink(".", "links/dot")
+		e.symlink("..", "links/up")
+	}
+
+	reads := []struct {
+		path string
+		want string
+	}{
+		{"links/rel/file", "c"},
+		{"links/abs/file", "c"},
+		{"links/chain/file", "c"},
+		{"links/file", "root"},
+		{"links/rel/../file", "b"},
+		{"links/abs/../file", "b"},
+		{"links/rel/../../file", "a"},
+		{"links/chain/../../file", "a"},
+		{"links/dot/file", "root"},
+		{"links/dot/dot/dot/file", "root"},
+		{"links/up/file", "root"},
+		{"links/up/links/rel/file", "c"},
+		{"a/../links/rel/file", "c"},
+	}
+	for _, c := range reads {
+		run(t, factory, "Read/"+c.path, func(e *env) {
+			setup(e)
+			e.checkFile(c.path, c.want)
+		})
+	}
+
+	statErrors := []struct {
+		path string
+		want error
+	}{
+		{"links/dangling", syscall.ENOENT},
+		{"links/loop1", syscall.ELOOP},
+		{"links/self", syscall.ELOOP},
+		{"links/loop1/file", syscall.ELOOP},
+		{"links/throughfile", syscall.ENOTDIR},
+		{"links/file/", syscall.ENOTDIR},
+		{"links/dangling/", syscall.ENOENT},
+	}
+	for _, c := range statErrors {
+		run(t, factory, "Stat/"+c.path, func(e *env) {
+			setup(e)
+			_, err := e.fs.Stat(e.path(c.path))
+			checkPathError(e.t, err, "stat", c.want)
+		})
+	}
+
+	lstats := []struct {
+		path string
+		typ  os.FileMode
+	}{
+		{"links/rel", os.ModeSymlink},
+		{"links/dangling", os.ModeSymlink},
+		{"links/loop1", os.ModeSymlink},
+		{"links/rel/", os.ModeDir},
+		{"links/rel/.", os.ModeDir},
+		{"links/up/links", os.ModeDir},
+		{"links/chain/file", 0},
+	}
+	for _, c := range lstats {
+		run(t, factory, "Lstat/"+c.path, func(e *env) {
+			setup(e)
+			e.checkType(c.path, c.typ)
+		})
+	}
+
+	readlinks := []struct {
+		path string
+		want string
+	}{
+		{"links/rel", "../a/b/c"},
+		{"links/chain", "rel"},
+		{"links/dangling", "missing"},
+		{"links/loop1", "loop2"},
+		{"links/up/links/dot", "."},
+	}
+	for _, c := range readlinks {
+		run(t, factory, "Readlink/"+c.path, func(e *env) {
+			setup(e)
+			target, err := e.fs.Readlink(e.path(c.path))
+			checkNil(e.t, err, "Readlink")
+			if target != c.want {
+				e.t.Fatalf("Unexpected target: '%v'", target)
+			}
+		})
+	}
+
+	run(t, factory, "ReadlinkAbs", func(e *env) {
+		setup(e)
+		target, err := e.fs.Readlink(e.path("links/abs"))
+		checkNil(e.t, err, "Readlink")
+		if target != e.path("a/b/c") {
+			e.t.Fatalf("Unexpected target: '%v'", target)
+		}
+	})
+
+	readlinkErrors := []struct {
+		path string
+		want error
+	}{
+		{"file", syscall.EINVAL},
+		{"a", syscall.EINVAL},
+		{"missing", syscall.ENOENT},
+		{"links/dangling/", syscall.ENOENT},
+	}
+	for _, c := range readlinkErrors {
+		run(t, factory, "ReadlinkError/"+c.path, func(e *env) {
+			setup(e)
+			_, err := e.fs.Readlink(e.path(c.path))
+			checkPathError(e.t, err, "readlink", c.want)
+		})
+	}
+
+	symlinkErrors := []struct {
+		path string
+		want error
+	}{
+		{"file", syscall.EEXIST},
+		{"a", syscall.EEXIST},
+		{"links/rel", syscall.EEXIST},
+		{"links/dangling", syscall.EEXIST},
+		{"missing/link", syscall.ENOENT},
+		{"file/link", syscall.ENOTDIR},
+	}
+	for _, c := range symlinkErrors {
+		run(t, factory, "SymlinkError/"+c.path, func(e *env) {
+			setup(e)
+			err := e.fs.Symlink("target", e.path(c.path))
+			checkLinkError(e.t, err, "symlink", c.want)
+		})
+	}
+
+	run(t, factory, "SymlinkTooLong", func(e *env) {
+		err := e.fs.Symlink(strings.Repeat("x", 5000), e.path("link"))
+		checkLinkError(e.t, err, "symlink", syscall.ENAMETOOLONG)
+	})
+
+	run(t, factory, "NameTooLong", func(e *env) {
+		_, err := e.fs.Stat(e.path(strings.Repeat("x", 256)))
+		checkPathError(e.t, err, "stat", syscall.ENAMETOOLONG)
+	})
+
+	run(t, factory, "CreateThroughDangling", func(e *env) {
+		setup(e)
+		f, err := e.fs.Create(e.path("links/dangling"))
+		checkNil(e.t, err, "Create")
+		f.Write([]byte("created"))
+		f.Close()
+		e.checkFile("links/missing", "created")
+		e.checkType("links/dangling", os.ModeSymlink)
+	})
+
+	run(t, factory, "WriteThrough", func(e *env) {
+		setup(e)
+		e.writeFile("links/rel/file", "changed")
+		e.checkFile("a/b/c/file", "changed")
+		e.checkType("links/rel", os.ModeSymlink)
+	})
+
+	run(t, factory, "ChmodThrough", func(e *env) {
+		setup(e)
+		checkNil(e.t, e.fs.Chmod(e.path("links/file"), os.FileMode(0600)), "Chmod")
+		fi, err := e.fs.Stat(e.path("file"))
+		checkNil(e.t, err, "Stat")
+		if fi.Mode() != os.FileMode(0600) {
+			e.t.Fatalf("Unexpected mode: %v", fi.Mode())
+		}
+	})
+
+	run(t, factory, "RemoveTargetLeavesLink", func(e *env) {
+		setup(e)
+		checkNil(e.t, e.fs.Remove(e.path("file")), "Remove")
+		e.checkType("links/file", os.ModeSymlink)
+		_, err := e.fs.Stat(e.path("links/file"))
+		checkPathError(e.t, err, "stat", syscall.ENOENT)
+	})
+}
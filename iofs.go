@@ -0,0 +1,333 @@
+package gofs
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type ioFilesystem struct {
+	fsys iofs.FS
+	cwd  string
+}
+
+// IoFs creates a read-only FileSystem backed by an io/fs.FS, such as an
+// embed.FS or an fstest.MapFS. The root of fsys appears as "/". Methods that
+// would modify the file system fail with syscall.EROFS.
+func IoFs(fsys iofs.FS) FileSystem {
+	return &ioFilesystem{
+		fsys: fsys,
+		cwd:  "/",
+	}
+}
+
+// readOnly returns the error produced by a mutating method on a read-only
+// FileSystem.
+func readOnly(op string, path string) error {
+	return &os.PathError{
+		Op:   op,
+		Err:  syscall.EROFS,
+		Path: path,
+	}
+}
+
+// readOnlyMkdirAll is MkdirAll on a read-only FileSystem, which like
+// os.MkdirAll has nothing to do if the directory is already there.
+func readOnlyMkdirAll(fs FileSystem, path string) error {
+	info, err := fs.Stat(path)
+	switch {
+	case err != nil:
+		return readOnly("mkdir", path)
+	case !info.IsDir():
+		return &os.PathError{
+			Op:   "mkdir",
+			Err:  syscall.ENOTDIR,
+			Path: path,
+		}
+	}
+	return nil
+}
+
+func (fs *ioFilesystem) abs(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(fs.cwd, path)
+}
+
+// ioName converts a FileSystem path into a name in the underlying io/fs.FS.
+func (fs *ioFilesystem) ioName(path string) string {
+	name := strings.TrimPrefix(filepath.ToSlash(fs.abs(path)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// pathErr rewrites the path in an error returned by the underlying io/fs.FS so
+// that callers see the path they passed in.
+func pathErr(op string, path string, err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		op = pe.Op
+		err = pe.Err
+	}
+	return &os.PathError{
+		Op:   op,
+		Err:  err,
+		Path: path,
+	}
+}
+
+func (fs *ioFilesystem) Stat(name string) (os.FileInfo, error) {
+	info, err := iofs.Stat(fs.fsys, fs.ioName(name))
+	if err != nil {
+		return nil, pathErr("stat", name, err)
+	}
+	return info, nil
+}
+
+func (fs *ioFilesystem) Getwd() (string, error) {
+	return fs.cwd, nil
+}
+
+func (fs *ioFilesystem) Chdir(dir string) error {
+	info, err := fs.Stat(dir)
+	if err != nil {
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return &os.PathError{
+			Op:   "chdir",
+			Err:  err,
+			Path: dir,
+		}
+	}
+	if !info.IsDir() {
+		return &os.PathError{
+			Op:   "chdir",
+			Err:  syscall.ENOTDIR,
+			Path: dir,
+		}
+	}
+	fs.cwd = fs.abs(dir)
+	return nil
+}
+
+func (fs *ioFilesystem) Abs(path string) (string, error) {
+	return fs.abs(path), nil
+}
+
+func (fs *ioFilesystem) Chmod(name string, mode os.FileMode) error {
+	return readOnly("chmod", name)
+}
+
+func (fs *ioFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return readOnly("chtimes", name)
+}
+
+func (fs *ioFilesystem) Chown(name string, uid, gid int) error {
+	return readOnly("chown", name)
+}
+
+func (fs *ioFilesystem) Lchown(name string, uid, gid int) error {
+	return readOnly("lchown", name)
+}
+
+func (fs *ioFilesystem) Lstat(name string) (os.FileInfo, error) {
+	rl, ok := fs.fsys.(iofs.ReadLinkFS)
+	if !ok {
+		info, err := iofs.Stat(fs.fsys, fs.ioName(name))
+		if err != nil {
+			return nil, pathErr("lstat", name, err)
+		}
+		return info, nil
+	}
+	info, err := rl.Lstat(fs.ioName(name))
+	if err != nil {
+		return nil, pathErr("lstat", name, err)
+	}
+	return info, nil
+}
+
+func (fs *ioFilesystem) Readlink(name string) (string, error) {
+	rl, ok := fs.fsys.(iofs.ReadLinkFS)
+	if !ok {
+		// Without fs.ReadLinkFS there are no symlinks, so the best we can do
+		// is tell existing files from missing ones.
+		if _, err := iofs.Stat(fs.fsys, fs.ioName(name)); err != nil {
+			return "", pathErr("readlink", name, err)
+		}
+		return "", &os.PathError{
+			Op:   "readlink",
+			Err:  syscall.EINVAL,
+			Path: name,
+		}
+	}
+	target, err := rl.ReadLink(fs.ioName(name))
+	if err != nil {
+		return "", pathErr("readlink", name, err)
+	}
+	return target, nil
+}
+
+func (fs *ioFilesystem) Symlink(oldname, newname string) error {
+	return linkError("symlink", oldname, newname, syscall.EROFS)
+}
+
+func (fs *ioFilesystem) Link(oldname, newname string) error {
+	return linkError("link", oldname, newname, syscall.EROFS)
+}
+
+func (fs *ioFilesystem) Mkdir(path string, perm os.FileMode) error {
+	return readOnly("mkdir", path)
+}
+
+func (fs *ioFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	return readOnlyMkdirAll(fs, path)
+}
+
+func (fs *ioFilesystem) Open(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *ioFilesystem) Create(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(0666))
+}
+
+func (fs *ioFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, readOnly("open", name)
+	}
+	file, err := fs.fsys.Open(fs.ioName(name))
+	if err != nil {
+		return nil, pathErr("open", name, err)
+	}
+	return &ioFile{
+		name: name,
+		file: file,
+	}, nil
+}
+
+func (fs *ioFilesystem) Truncate(name string, size int64) error {
+	return readOnly("truncate", name)
+}
+
+func (fs *ioFilesystem) Remove(name string) error {
+	return readOnly("remove", name)
+}
+
+func (fs *ioFilesystem) RemoveAll(path string) error {
+	return readOnly("RemoveAll", path)
+}
+
+func (fs *ioFilesystem) Rename(oldpath, newpath string) error {
+	return linkError("rename", oldpath, newpath, syscall.EROFS)
+}
+
+// ioFile adapts an io/fs.File to the File interface.
+type ioFile struct {
+	name string
+	file iofs.File
+}
+
+func (f *ioFile) Name() string {
+	return f.name
+}
+
+func (f *ioFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *ioFile) Chmod(mode os.FileMode) error {
+	return readOnly("chmod", f.name)
+}
+
+func (f *ioFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	dir, ok := f.file.(iofs.ReadDirFile)
+	if !ok {
+		return nil, &os.PathError{
+			Op:   "readdirent",
+			Err:  syscall.ENOTDIR,
+			Path: f.name,
+		}
+	}
+	return dir.ReadDir(n)
+}
+
+func (f *ioFile) Readdirnames(n int) ([]string, error) {
+	entries, err := f.ReadDir(n)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, err
+}
+
+func (f *ioFile) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := f.ReadDir(n)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, ierr := entry.Info()
+		if ierr != nil {
+			return infos, ierr
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (f *ioFile) Read(b []byte) (int, error) {
+	return f.file.Read(b)
+}
+
+func (f *ioFile) Write(b []byte) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+
+func (f *ioFile) ReadAt(b []byte, off int64) (int, error) {
+	readerAt, ok := f.file.(io.ReaderAt)
+	if !ok {
+		return 0, &os.PathError{
+			Op:   "read",
+			Err:  errors.ErrUnsupported,
+			Path: f.name,
+		}
+	}
+	return readerAt.ReadAt(b, off)
+}
+
+func (f *ioFile) WriteAt(b []byte, off int64) (int, error) {
+	return 0, readOnly("write", f.name)
+}
+
+func (f *ioFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.file.(io.Seeker)
+	if !ok {
+		return 0, &os.PathError{
+			Op:   "seek",
+			Err:  errors.ErrUnsupported,
+			Path: f.name,
+		}
+	}
+	return seeker.Seek(offset, whence)
+}
+
+func (f *ioFile) Truncate(size int64) error {
+	return readOnly("truncate", f.name)
+}
+
+func (f *ioFile) Sync() error {
+	// Nothing to flush on a read-only file.
+	return nil
+}
+
+func (f *ioFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,151 @@
+package gofs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+func testReadOnly(t *testing.T, op string, err error) {
+	t.Run(op, func(t *testing.T) {
+		var pe *os.PathError
+		if !errors.As(err, &pe) {
+			t.Fatalf("Expected *os.PathError, got '%v'", err)
+		}
+		if !errors.Is(err, syscall.EROFS) {
+			t.Fatalf("Expected EROFS, got '%v'", err)
+		}
+	})
+}
+
+// testReadOnlyLink is testReadOnly for the methods that take two paths.
+func testReadOnlyLink(t *testing.T, op string, err error) {
+	t.Run(op, func(t *testing.T) {
+		var le *os.LinkError
+		if !errors.As(err, &le) {
+			t.Fatalf("Expected *os.LinkError, got '%v'", err)
+		}
+		if !errors.Is(err, syscall.EROFS) {
+			t.Fatalf("Expected EROFS, got '%v'", err)
+		}
+	})
+}
+
+func TestIoFs(t *testing.T) {
+	fs := IoFs(fstest.MapFS{
+		"foo/hello":  {Data: []byte("Hello World"), Mode: 0644},
+		"foo/bar/ok": {Data: []byte("ok"), Mode: 0600},
+		"link":       {Data: []byte("foo/hello"), Mode: os.ModeSymlink | 0777},
+	})
+
+	t.Run("ReadFile", func(t *testing.T) {
+		data, err := ReadFile(fs, "/foo/hello")
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadFile: %v", err)
+		}
+		if string(data) != "Hello World" {
+			t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	t.Run("Chdir", func(t *testing.T) {
+		if err := fs.Chdir("foo"); err != nil {
+			t.Fatalf("Unexpected error from Chdir: %v", err)
+		}
+		defer fs.Chdir("/")
+
+		data, err := ReadFile(fs, "bar/ok")
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadFile: %v", err)
+		}
+		if string(data) != "ok" {
+			t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+
+	t.Run("ChdirNotExist", func(t *testing.T) {
+		err := fs.Chdir("/bogus")
+		var pe *os.PathError
+		if !errors.As(err, &pe) || pe.Op != "chdir" || !os.IsNotExist(err) {
+			t.Fatalf("Expected chdir not exist, got '%v'", err)
+		}
+	})
+
+	t.Run("Readdir", func(t *testing.T) {
+		infos, err := ReadDir(fs, "/foo")
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadDir: %v", err)
+		}
+		if len(infos) != 2 || infos[0].Name() != "bar" || infos[1].Name() != "hello" {
+			t.Fatalf("Unexpected entries: %v", infos)
+		}
+	})
+
+	t.Run("Symlink", func(t *testing.T) {
+		info, err := fs.Lstat("/link")
+		if err != nil {
+			t.Fatalf("Unexpected error from Lstat: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("Expected a symlink, got %v", info.Mode())
+		}
+		target, err := fs.Readlink("/link")
+		if err != nil {
+			t.Fatalf("Unexpected error from Readlink: %v", err)
+		}
+		if target != "foo/hello" {
+			t.Fatalf("Unexpected target: '%v'", target)
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		_, err := fs.Stat("/foo/bogus")
+		if !os.IsNotExist(err) {
+			t.Fatalf("Expected not exist, got '%v'", err)
+		}
+	})
+
+	f, err := fs.Open("/foo/hello")
+	if err != nil {
+		t.Fatalf("Unexpected error from Open: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(6, io.SeekStart); err != nil {
+		t.Fatalf("Unexpected error from Seek: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil || string(data) != "World" {
+		t.Fatalf("Unexpected read result: '%v', %v", string(data), err)
+	}
+
+	_, err = fs.Create("/foo/new")
+	testReadOnly(t, "Create", err)
+	_, err = fs.OpenFile("/foo/hello", os.O_WRONLY, 0)
+	testReadOnly(t, "OpenFile", err)
+	testReadOnly(t, "Mkdir", fs.Mkdir("/foo/new", 0755))
+	testReadOnly(t, "MkdirAll", fs.MkdirAll("/foo/new/dir", 0755))
+	if err := fs.MkdirAll("/foo/bar", 0755); err != nil {
+		t.Fatalf("Unexpected error from MkdirAll: %v", err)
+	}
+	if err := fs.MkdirAll("/foo/hello", 0755); !errors.Is(err, syscall.ENOTDIR) {
+		t.Fatalf("Expected ENOTDIR, got '%v'", err)
+	}
+	testReadOnly(t, "Chmod", fs.Chmod("/foo/hello", 0600))
+	testReadOnlyLink(t, "Symlink", fs.Symlink("/foo/hello", "/foo/link"))
+	testReadOnlyLink(t, "Link", fs.Link("/foo/hello", "/foo/link"))
+	testReadOnly(t, "Truncate", fs.Truncate("/foo/hello", 0))
+	testReadOnly(t, "Remove", fs.Remove("/foo/hello"))
+	err = fs.RemoveAll("/foo")
+	testReadOnly(t, "RemoveAll", err)
+	if pe, ok := err.(*os.PathError); ok && pe.Op != "RemoveAll" {
+		t.Fatalf("Unexpected op: %v", pe.Op)
+	}
+	testReadOnlyLink(t, "Rename", fs.Rename("/foo/hello", "/foo/bye"))
+	_, err = f.Write([]byte("x"))
+	testReadOnly(t, "Write", err)
+	testReadOnly(t, "File.Truncate", f.Truncate(0))
+	testReadOnly(t, "File.Chmod", f.Chmod(0600))
+}
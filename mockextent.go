@@ -0,0 +1,87 @@
+package gofs
+
+import "slices"
+
+// mockBlockSize is the granularity at which MockFs keeps track of which parts
+// of a file hold data and which are holes, as most Linux file systems do.
+const mockBlockSize = 4096
+
+// extent is a run of blocks, from start up to but not including end.
+type extent struct {
+	start int64
+	end   int64
+}
+
+// extents lists the blocks of a file that have been written to, in order,
+// with no two runs touching. Everything else is a hole, which reads as zeros.
+type extents []extent
+
+// add marks the blocks holding the bytes from start up to end as data.
+func (e extents) add(start, end int64) extents {
+	if end <= start {
+		return e
+	}
+	s := start / mockBlockSize
+	t := (end + mockBlockSize - 1) / mockBlockSize
+
+	// Merge with any runs that overlap or touch the new one.
+	i := 0
+	for i < len(e) && e[i].end < s {
+		i++
+	}
+	j := i
+	for j < len(e) && e[j].start <= t {
+		s = min(s, e[j].start)
+		t = max(t, e[j].end)
+		j++
+	}
+	return slices.Concat(e[:i], extents{{s, t}}, e[j:])
+}
+
+// truncate drops any blocks past the end of a file of the given size.
+func (e extents) truncate(size int64) extents {
+	n := (size + mockBlockSize - 1) / mockBlockSize
+	var ret extents
+	for _, x := range e {
+		if x.start >= n {
+			break
+		}
+		ret = append(ret, extent{x.start, min(x.end, n)})
+	}
+	return ret
+}
+
+// blocks returns the number of blocks holding data.
+func (e extents) blocks() int64 {
+	var ret int64
+	for _, x := range e {
+		ret += x.end - x.start
+	}
+	return ret
+}
+
+// data returns the offset of the first byte of data at or after off, if there
+// is one.
+func (e extents) data(off int64) (int64, bool) {
+	for _, x := range e {
+		if x.end*mockBlockSize > off {
+			return max(off, x.start*mockBlockSize), true
+		}
+	}
+	return 0, false
+}
+
+// hole returns the offset of the first byte of a hole at or after off. There's
+// always one after the last run of data.
+func (e extents) hole(off int64) int64 {
+	for _, x := range e {
+		if x.start*mockBlockSize > off {
+			break
+		}
+		if x.end*mockBlockSize > off {
+			// Runs never touch, so the next block is a hole.
+			return x.end * mockBlockSize
+		}
+	}
+	return off
+}
@@ -3,14 +3,72 @@ package gofs
 import (
 	"errors"
 	"io"
+	iofs "io/fs"
 	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
 )
 
 // Mock implementation of the gofs.File interface.
 type mockFile struct {
-	name     string
-	info     *mockFileInfo
-	position int
+	fs   *mockFileSystem
+	name string
+	info *mockInode
+	flag int
+
+	// Whether info is a directory, which can't change.
+	dir bool
+
+	// The file system's epoch when the file was opened. The file is closed
+	// once Restore moves it on to another.
+	epoch uint64
+
+	// Whether Close has been called, guarded by the file system's lock so
+	// that ReadAt can check it without taking mu.
+	closed bool
+
+	// mu guards position and the directory cursor.
+	mu       sync.Mutex
+	position int64
+
+	// The names in a directory that are still to be read, listed on the first
+	// read.
+	names  []string
+	listed bool
+}
+
+// mockCopyChunk is how much ReadFrom reads at a time, the same as io.Copy.
+const mockCopyChunk = 32 * 1024
+
+// errWriteAtInAppendMode is the error os.File returns for WriteAt on a file
+// opened with O_APPEND.
+var errWriteAtInAppendMode = errors.New("os: invalid use of WriteAt on file opened with O_APPEND")
+
+func (f *mockFile) pathErr(op string, err error) error {
+	return &os.PathError{
+		Op:   op,
+		Err:  err,
+		Path: f.name,
+	}
+}
+
+// checkValid returns an error if the file has been closed. The file system's
+// lock must be held.
+func (f *mockFile) checkValid(op string) error {
+	if f.closed || f.epoch != f.fs.epoch {
+		return f.pathErr(op, os.ErrClosed)
+	}
+	return nil
+}
+
+// canRead and canWrite check the access mode the file was opened with.
+func (f *mockFile) canRead() bool {
+	return f.flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) != os.O_WRONLY
+}
+
+func (f *mockFile) canWrite() bool {
+	return f.flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) != os.O_RDONLY
 }
 
 func (f *mockFile) Name() string {
@@ -18,121 +76,350 @@ func (f *mockFile) Name() string {
 }
 
 func (f *mockFile) Stat() (os.FileInfo, error) {
-	return f.info, nil
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("stat"); err != nil {
+		return nil, err
+	}
+	return f.fs.current(f.info).info(filepath.Base(f.name)), nil
 }
 
 func (f *mockFile) Chmod(mode os.FileMode) error {
-	f.info.mode = (f.info.mode & os.ModeType) | (mode & os.ModePerm)
-	return nil
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.checkValid("chmod"); err != nil {
+		return err
+	}
+	return f.fs.chmod("chmod", f.name, f.fs.current(f.info), mode)
 }
 
-func (f *mockFile) Readdir(n int) ([]os.FileInfo, error) {
-	if !f.info.mode.IsDir() {
-		return nil, errors.New("not a directory")
+// readdir returns the next n entries in the directory, or all the rest if n <=
+// 0. Like os.File, it returns io.EOF if n > 0 and there are none left.
+func (f *mockFile) readdir(n int) ([]*mockFileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("readdirent"); err != nil {
+		return nil, err
+	}
+	if !f.dir {
+		return nil, f.pathErr("readdirent", syscall.ENOTDIR)
 	}
 
-	var ret []os.FileInfo
-	for _, v := range f.info.children {
-		if n > 0 && len(ret) >= n {
-			break
+	info := f.fs.current(f.info)
+	if !f.listed {
+		f.names = f.fs.list(info)
+		f.listed = true
+	}
+	var ret []*mockFileInfo
+	for len(f.names) > 0 && (n <= 0 || len(ret) < n) {
+		name := f.names[0]
+		f.names = f.names[1:]
+		if child := info.children[name]; child != nil {
+			// Anything removed since the directory was listed is skipped.
+			ret = append(ret, f.fs.current(child).info(name))
 		}
-		ret = append(ret, v)
+	}
+	if n > 0 && len(ret) == 0 {
+		return nil, io.EOF
 	}
 	return ret, nil
 }
 
+func (f *mockFile) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := f.readdir(n)
+	ret := make([]os.FileInfo, len(infos))
+	for i, info := range infos {
+		ret[i] = info
+	}
+	return ret, err
+}
+
+func (f *mockFile) Readdirnames(n int) ([]string, error) {
+	infos, err := f.readdir(n)
+	ret := make([]string, len(infos))
+	for i, info := range infos {
+		ret[i] = info.name
+	}
+	return ret, err
+}
+
+func (f *mockFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	infos, err := f.readdir(n)
+	ret := make([]iofs.DirEntry, len(infos))
+	for i, info := range infos {
+		ret[i] = iofs.FileInfoToDirEntry(info)
+	}
+	return ret, err
+}
+
 func (f *mockFile) Read(b []byte) (int, error) {
-	if f.position == -1 {
-		return 0, errors.New("closed")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("read"); err != nil {
+		return 0, err
+	}
+	if !f.canRead() {
+		return 0, f.pathErr("read", syscall.EBADF)
 	}
-	if !f.info.mode.IsRegular() {
-		return 0, errors.New("not a regular file")
+	if f.dir {
+		return 0, f.pathErr("read", syscall.EISDIR)
 	}
-	if f.position >= len(f.info.data) {
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n := f.fs.own(f.info).read(b, f.position, f.fs.now())
+	if n == 0 {
 		return 0, io.EOF
 	}
-	ret := copy(b, f.info.data[f.position:])
-	f.position += ret
-	return ret, nil
+	f.position += int64(n)
+	return n, nil
+}
+
+// ReadAt leaves the position alone, so it only needs the inode's lock, and
+// any number of them can run at once.
+func (f *mockFile) ReadAt(b []byte, off int64) (int, error) {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("read"); err != nil {
+		return 0, err
+	}
+	if !f.canRead() {
+		return 0, f.pathErr("read", syscall.EBADF)
+	}
+	if f.dir {
+		return 0, f.pathErr("read", syscall.EISDIR)
+	}
+	if off < 0 {
+		return 0, f.pathErr("readat", errors.New("negative offset"))
+	}
+
+	// Like os.File, either fill b or say why not.
+	n := f.fs.own(f.info).read(b, off, f.fs.now())
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteTo is a fast path for io.Copy, which reads the rest of the file in one
+// go.
+func (f *mockFile) WriteTo(w io.Writer) (int64, error) {
+	buf, err := f.readAll()
+	if err != nil {
+		return 0, err
+	}
+
+	// w may well be another File, so don't hold any locks while writing to
+	// it.
+	written, err := w.Write(buf)
+	if err == nil && written < len(buf) {
+		err = io.ErrShortWrite
+	}
+	return int64(written), err
+}
+
+// readAll reads the rest of the file.
+func (f *mockFile) readAll() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("read"); err != nil {
+		return nil, err
+	}
+	if !f.canRead() {
+		return nil, f.pathErr("read", syscall.EBADF)
+	}
+	if f.dir {
+		return nil, f.pathErr("read", syscall.EISDIR)
+	}
+	info := f.fs.own(f.info)
+	buf := make([]byte, max(info.size()-f.position, 0))
+	n := info.read(buf, f.position, f.fs.now())
+	f.position += int64(n)
+	return buf[:n], nil
 }
 
 func (f *mockFile) Write(b []byte) (int, error) {
-	if f.position == -1 {
-		return 0, errors.New("closed")
-	}
-	if !f.info.mode.IsRegular() {
-		return 0, errors.New("not a regular file")
-	}
-
-	pos := 0
-	for pos < len(b) {
-		l := len(b) - pos
-		if f.position == len(f.info.data) {
-			// Append.
-			f.info.data = append(f.info.data, b[pos:]...)
-			f.position += l
-			pos += l
-		} else {
-			// In-place write.
-			copied := copy(f.info.data[f.position:], b[pos:])
-			f.position += copied
-			pos += copied
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("write"); err != nil {
+		return 0, err
+	}
+	if !f.canWrite() {
+		return 0, f.pathErr("write", syscall.EBADF)
+	}
+	if f.dir {
+		return 0, f.pathErr("write", syscall.EISDIR)
+	}
+
+	// Appends always go to the end, wherever the file was left.
+	f.position = f.fs.own(f.info).write(b, f.position, f.flag&os.O_APPEND == os.O_APPEND, f.fs.now())
+	return len(b), nil
+}
+
+func (f *mockFile) WriteAt(b []byte, off int64) (int, error) {
+	if f.flag&os.O_APPEND == os.O_APPEND {
+		return 0, errWriteAtInAppendMode
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("write"); err != nil {
+		return 0, err
+	}
+	if !f.canWrite() {
+		return 0, f.pathErr("write", syscall.EBADF)
+	}
+	if f.dir {
+		return 0, f.pathErr("write", syscall.EISDIR)
+	}
+	if off < 0 {
+		return 0, f.pathErr("writeat", errors.New("negative offset"))
+	}
+
+	f.fs.own(f.info).write(b, off, false, f.fs.now())
+	return len(b), nil
+}
+
+// ReadFrom is io.Copy into the file. It checks that the file can be written
+// before reading anything from r, then copies it a chunk at a time, so however
+// much r has, it's never all in memory at once.
+func (f *mockFile) ReadFrom(r io.Reader) (int64, error) {
+	f.mu.Lock()
+	f.fs.mu.RLock()
+	err := f.checkValid("write")
+	if err == nil && !f.canWrite() {
+		err = f.pathErr("write", syscall.EBADF)
+	}
+	f.fs.mu.RUnlock()
+	f.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, mockCopyChunk)
+	var written int64
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			// Write rather than WriteAt, so that the position moves on and
+			// appends go to the end.
+			n, err := f.Write(buf[:n])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
 		}
 	}
-	return pos, nil
 }
 
 func (f *mockFile) Seek(offset int64, whence int) (int64, error) {
-	if f.position == -1 {
-		return 0, errors.New("closed")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("seek"); err != nil {
+		return 0, err
 	}
-	if !f.info.mode.IsRegular() {
-		return 0, errors.New("not a regular file")
+	if f.dir {
+		// The only place worth seeking to in a directory is the start, to
+		// read it again.
+		if offset != 0 || whence != io.SeekStart {
+			return 0, f.pathErr("seek", syscall.EINVAL)
+		}
+		f.names = nil
+		f.listed = false
+		return 0, nil
 	}
 
+	// Like lseek, anywhere from the start of the file on is fine, even past
+	// the end.
+	var base int64
 	switch whence {
-	case os.SEEK_SET:
-		if offset < 0 || offset > int64(len(f.info.data)) {
-			return 0, errors.New("offset out of bounds")
-		}
-		f.position = int(offset)
-	case os.SEEK_CUR:
-		if offset < int64(-f.position) || offset > int64(len(f.info.data)-f.position) {
-			return 0, errors.New("offset out of bounds")
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = f.position
+	case io.SeekEnd:
+		base = f.fs.current(f.info).size()
+	case seekData, seekHole:
+		pos, ok := f.fs.current(f.info).seekData(offset, whence == seekHole)
+		if !ok {
+			return 0, f.pathErr("seek", syscall.ENXIO)
 		}
-		f.position = int(int64(f.position) + offset)
-	case os.SEEK_END:
-		if offset < 0 || offset > int64(len(f.info.data)) {
-			return 0, errors.New("offset out of bounds")
-		}
-		f.position = len(f.info.data) - int(offset)
+		f.position = pos
+		return pos, nil
+	default:
+		return 0, f.pathErr("seek", syscall.EINVAL)
+	}
+	pos := base + offset
+	if pos < 0 || (offset > 0 && pos < base) {
+		return 0, f.pathErr("seek", syscall.EINVAL)
 	}
-	return int64(f.position), nil
+	f.position = pos
+	return pos, nil
 }
 
 func (f *mockFile) Truncate(size int64) error {
-	if size < 0 {
-		return errors.New("size out of bounds")
-	}
-	if !f.info.mode.IsRegular() {
-		return errors.New("not a regular file")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("truncate"); err != nil {
+		return err
 	}
-	if size < int64(len(f.info.data)) {
-		f.info.data = f.info.data[0:size]
-	} else {
-		buf := make([]byte, size)
-		copy(buf, f.info.data)
-		f.info.data = buf
+	// Linux says EINVAL rather than EBADF for a file that isn't open for
+	// writing.
+	if size < 0 || f.dir || !f.canWrite() {
+		return f.pathErr("truncate", syscall.EINVAL)
 	}
+	f.fs.own(f.info).truncate(size, f.fs.now())
 	return nil
 }
 
 func (f *mockFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.checkValid("sync"); err != nil {
+		return err
+	}
 	// no-op.
 	return nil
 }
 
 func (f *mockFile) Close() error {
-	f.position = -1
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.checkValid("close"); err != nil {
+		return err
+	}
+	f.closed = true
+
+	info := f.fs.own(f.info)
+	info.open--
+	info.release()
 	return nil
 }
@@ -5,14 +5,23 @@ import (
 	"time"
 )
 
-// A mock implementation of the os.FileInfo interface.
+// A mock implementation of the os.FileInfo interface. Like the real thing, it
+// is a snapshot of the inode taken when it was created.
 
 type mockFileInfo struct {
-	name     string
-	mode     os.FileMode
-	parent   *mockFileInfo
-	children map[string]*mockFileInfo
-	data     []byte
+	name  string
+	size  int64
+	mode  os.FileMode
+	ino   uint64
+	uid   int
+	gid   int
+	nlink uint64
+	atime time.Time
+	mtime time.Time
+	ctime time.Time
+
+	// The number of mockBlockSize blocks holding data.
+	blocks int64
 }
 
 func (fi *mockFileInfo) Name() string {
@@ -20,7 +29,7 @@ func (fi *mockFileInfo) Name() string {
 }
 
 func (fi *mockFileInfo) Size() int64 {
-	return int64(len(fi.data))
+	return fi.size
 }
 
 func (fi *mockFileInfo) Mode() os.FileMode {
@@ -28,14 +37,15 @@ func (fi *mockFileInfo) Mode() os.FileMode {
 }
 
 func (fi *mockFileInfo) ModTime() time.Time {
-	// Mod times are not supported.
-	return time.Unix(0, 0)
+	return fi.mtime
 }
 
 func (fi *mockFileInfo) IsDir() bool {
 	return fi.mode.IsDir()
 }
 
+// Sys returns a *syscall.Stat_t describing the file on Linux, and nil
+// elsewhere.
 func (fi *mockFileInfo) Sys() interface{} {
-	return nil
+	return fi.sys()
 }
@@ -0,0 +1,69 @@
+package gofs
+
+import (
+	"os"
+	"syscall"
+)
+
+// The device number reported for every mock file.
+const mockDev = 0x4d4f434b
+
+// Stat_t field types differ between architectures; these let us fill it in
+// without caring which we have.
+func setUint[T uint32 | uint64](dst *T, v uint64) {
+	*dst = T(v)
+}
+
+func setInt[T int32 | int64 | uint32](dst *T, v int64) {
+	*dst = T(v)
+}
+
+func (fi *mockFileInfo) sys() interface{} {
+	st := &syscall.Stat_t{
+		Dev:  mockDev,
+		Ino:  fi.ino,
+		Mode: unixMode(fi.mode),
+		Uid:  uint32(fi.uid),
+		Gid:  uint32(fi.gid),
+		Size: fi.Size(),
+		Atim: syscall.NsecToTimespec(fi.atime.UnixNano()),
+		Mtim: syscall.NsecToTimespec(fi.mtime.UnixNano()),
+		Ctim: syscall.NsecToTimespec(fi.ctime.UnixNano()),
+	}
+	setUint(&st.Nlink, fi.nlink)
+	setInt(&st.Blksize, mockBlockSize)
+	// st_blocks counts 512-byte units.
+	st.Blocks = fi.blocks * (mockBlockSize / 512)
+	return st
+}
+
+// unixMode converts an os.FileMode into st_mode bits.
+func unixMode(mode os.FileMode) uint32 {
+	ret := uint32(mode & os.ModePerm)
+	switch {
+	case mode.IsDir():
+		ret |= syscall.S_IFDIR
+	case mode&os.ModeSymlink != 0:
+		ret |= syscall.S_IFLNK
+	case mode&os.ModeNamedPipe != 0:
+		ret |= syscall.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		ret |= syscall.S_IFSOCK
+	case mode&os.ModeCharDevice != 0:
+		ret |= syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		ret |= syscall.S_IFBLK
+	default:
+		ret |= syscall.S_IFREG
+	}
+	if mode&os.ModeSetuid != 0 {
+		ret |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		ret |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		ret |= syscall.S_ISVTX
+	}
+	return ret
+}
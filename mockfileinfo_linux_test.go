@@ -0,0 +1,76 @@
+package gofs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSys(t *testing.T) {
+	mtime := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	fs := MockFs(WithIdentity(0, 0))
+	fs.MkdirAll("/foo/bar", os.FileMode(0755))
+	WriteFile(fs, "/foo/hello", []byte("Hello World"), os.FileMode(0640))
+	fs.Chown("/foo/hello", 1000, 100)
+	fs.Chtimes("/foo/hello", mtime, mtime)
+	fs.Symlink("/foo/hello", "/foo/link")
+	fs.Lchown("/foo/link", 1001, 101)
+
+	t.Run("File", func(t *testing.T) {
+		info, _ := fs.Stat("/foo/link")
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			t.Fatalf("Expected *syscall.Stat_t, got %T", info.Sys())
+		}
+		if st.Uid != 1000 || st.Gid != 100 {
+			t.Fatalf("Unexpected owner: %v:%v", st.Uid, st.Gid)
+		}
+		if st.Mode != syscall.S_IFREG|0640 {
+			t.Fatalf("Unexpected mode: %o", st.Mode)
+		}
+		if st.Size != 11 || st.Nlink != 1 {
+			t.Fatalf("Unexpected size or nlink: %v, %v", st.Size, st.Nlink)
+		}
+		if int64(st.Mtim.Sec) != mtime.Unix() {
+			t.Fatalf("Unexpected mtime: %v", st.Mtim)
+		}
+	})
+
+	t.Run("Symlink", func(t *testing.T) {
+		info, _ := fs.Lstat("/foo/link")
+		st := info.Sys().(*syscall.Stat_t)
+		if st.Uid != 1001 || st.Gid != 101 {
+			t.Fatalf("Unexpected owner: %v:%v", st.Uid, st.Gid)
+		}
+		if st.Mode&syscall.S_IFMT != syscall.S_IFLNK {
+			t.Fatalf("Unexpected mode: %o", st.Mode)
+		}
+	})
+
+	t.Run("Dir", func(t *testing.T) {
+		info, _ := fs.Stat("/foo")
+		st := info.Sys().(*syscall.Stat_t)
+		if st.Nlink != 3 {
+			t.Fatalf("Unexpected nlink: %v", st.Nlink)
+		}
+		other, _ := fs.Stat("/foo/bar")
+		if other.Sys().(*syscall.Stat_t).Ino == st.Ino {
+			t.Fatalf("Duplicate inode number: %v", st.Ino)
+		}
+	})
+
+	t.Run("Sparse", func(t *testing.T) {
+		f, _ := fs.Create("/foo/sparse")
+		f.Write([]byte("hello"))
+		f.WriteAt([]byte("world"), 10*mockBlockSize)
+		f.Close()
+
+		// Only the two blocks written to count, in 512-byte units.
+		info, _ := fs.Stat("/foo/sparse")
+		st := info.Sys().(*syscall.Stat_t)
+		if st.Blocks != 2*mockBlockSize/512 || st.Size != 10*mockBlockSize+5 {
+			t.Fatalf("Unexpected blocks or size: %v, %v", st.Blocks, st.Size)
+		}
+	})
+}
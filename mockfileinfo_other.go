@@ -0,0 +1,8 @@
+//go:build !linux
+
+package gofs
+
+func (fi *mockFileInfo) sys() interface{} {
+	// There's no portable way to describe a file.
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package gofs
+
+// Open flags that the os package doesn't define. They don't exist here, so
+// they're never set.
+const (
+	oNoFollow  = 0
+	oDirectory = 0
+)
@@ -0,0 +1,11 @@
+//go:build unix
+
+package gofs
+
+import "syscall"
+
+// Open flags that the os package doesn't define.
+const (
+	oNoFollow  = syscall.O_NOFOLLOW
+	oDirectory = syscall.O_DIRECTORY
+)
@@ -3,9 +3,14 @@ package gofs
 import (
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 // DebugFs is a file system that can dump its state for debug purposes.
@@ -14,164 +19,334 @@ type DebugFs interface {
 }
 
 type mockFileSystem struct {
-	root mockFileInfo
-	cwd  string
-}
+	// mu guards everything below, along with the directory tree and the
+	// metadata of every inode in it.
+	mu sync.RWMutex
 
-// MockFs creates a new mock FileSystem
-func MockFs() FileSystem {
-	return &mockFileSystem{
-		root: mockFileInfo{
-			name:     "/",
-			mode:     os.ModeDir | os.FileMode(0755),
-			parent:   nil,
-			children: make(map[string]*mockFileInfo),
-			data:     nil,
-		},
-		cwd: "/",
-	}
-}
+	root  *mockInode
+	cwd   *mockInode
+	clock Clock
+	ino   uint64
 
-func (fs *mockFileSystem) abs(path string) string {
-	if strings.HasPrefix(path, "/") {
-		return path
-	}
-	return filepath.Join(fs.cwd, path)
-}
+	// The generation of inodes that can be changed in place; any others are
+	// frozen in snapshots. Pointers to inodes may be to stale versions, so
+	// they always go through current or own, which look up the latest
+	// version of each copied inode in versions. Only its top layer changes,
+	// and that's guarded by vmu, so that inodes can be copied without the
+	// write lock.
+	gen      uint64
+	vmu      sync.Mutex
+	versions *mockVersions
 
-func split(path string) (string, string) {
-	return filepath.Dir(path), filepath.Base(path)
-}
+	// epoch counts the snapshots restored, each of which closes all the
+	// Files opened before it. restored is the generation the last one
+	// started, before which the inodes' open counts are stale.
+	epoch    uint64
+	restored uint64
 
-func (fs *mockFileSystem) splitAbs(path string) (string, string) {
-	return split(fs.abs(path))
+	// Whether directories are listed in a random order, and the seed for it.
+	shuffle bool
+	seed    uint64
+
+	// The current user, and whether permissions are enforced for them.
+	uid     int
+	gid     int
+	groups  []int
+	enforce bool
 }
 
-func (fs *mockFileSystem) find(path string) (*mockFileInfo, error) {
-	if path == "" || path == "/" {
-		return &fs.root, nil
+// MockOption configures a FileSystem created by MockFs.
+type MockOption func(*mockFileSystem)
+
+// WithClock makes MockFs take all of its timestamps from clock instead of the
+// system time.
+func WithClock(clock Clock) MockOption {
+	return func(fs *mockFileSystem) {
+		fs.clock = clock
 	}
-	if !strings.HasPrefix(path, "/") {
-		return nil, errors.New("path is not absolute")
+}
+
+// WithShuffledDirs makes MockFs list the entries in each directory in a random
+// order, derived from seed, instead of sorted by name. This helps shake out
+// code that depends on the order, which the os package doesn't promise.
+func WithShuffledDirs(seed int64) MockOption {
+	return func(fs *mockFileSystem) {
+		fs.shuffle = true
+		fs.seed = uint64(seed)
 	}
+}
 
-	dirPath := filepath.Dir(path)
-	dirInfo, err := fs.find(dirPath)
-	if err != nil {
-		return nil, err
+// MockFs creates a new mock FileSystem
+//
+// The FileSystem and the Files it opens are safe for concurrent use. Each
+// method takes effect atomically: Rename replaces an existing target in one
+// step, so nobody ever sees it missing; of several concurrent OpenFile calls
+// with O_CREATE|O_EXCL for the same name, exactly one succeeds; and nobody sees
+// RemoveAll partway through a tree. The exception is MkdirAll, which like
+// os.MkdirAll is a series of Mkdir calls. Reads and writes on a File are
+// atomic too, so concurrent writes never interleave.
+//
+// Atomic doesn't mean all or nothing, though: if RemoveAll fails partway, for
+// example on a directory it may not read, what it had already removed stays
+// removed, as with os.RemoveAll.
+func MockFs(opts ...MockOption) FileSystem {
+	fs := &mockFileSystem{
+		clock:    SystemClock(),
+		uid:      os.Getuid(),
+		gid:      os.Getgid(),
+		gen:      mockGen.Add(1),
+		versions: newMockVersions(nil),
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	// The root directory is its own parent.
+	fs.root = fs.newInode(nil, os.ModeDir|os.FileMode(0755))
+	fs.root.parent = fs.root
+	fs.root.nlink = 2
+	fs.cwd = fs.root
+	return fs
+}
+
+func (fs *mockFileSystem) now() time.Time {
+	return fs.clock.Now()
+}
+
+// newInode creates an inode, owned by the current user, that's about to be
+// linked into dirInfo.
+func (fs *mockFileSystem) newInode(dirInfo *mockInode, mode os.FileMode) *mockInode {
+	now := fs.now()
+	fs.ino++
+	info := &mockInode{
+		ino:   fs.ino,
+		gen:   fs.gen,
+		mode:  mode,
+		uid:   fs.uid,
+		gid:   fs.gid,
+		atime: now,
+		mtime: now,
+		ctime: now,
+	}
+	if dirInfo != nil {
+		uid, gid, inherit := fs.owner(dirInfo)
+		info.uid = uid
+		info.gid = gid
+		if mode.IsDir() {
+			info.mode |= inherit
+		}
 	}
-	if !dirInfo.mode.IsDir() {
-		return nil, os.ErrNotExist
+	if mode.IsDir() {
+		info.children = make(map[string]*mockInode)
+		// For its ".".
+		info.nlink = 1
 	}
+	return info
+}
 
-	info := dirInfo.children[filepath.Base(path)]
-	if info == nil {
-		return nil, os.ErrNotExist
+// link adds a directory entry for info to dirInfo.
+func (fs *mockFileSystem) link(dirInfo *mockInode, fileName string, info *mockInode) {
+	dirInfo = fs.own(dirInfo)
+	info = fs.own(info)
+	now := fs.now()
+	dirInfo.children[fileName] = info
+	dirInfo.modified(now)
+	info.nlink++
+	if info.isDir() {
+		// For the new directory's "..".
+		info.parent = dirInfo
+		dirInfo.nlink++
 	}
-
-	return fs.deref(info)
+	info.changed(now)
 }
 
-func (fs *mockFileSystem) deref(info *mockFileInfo) (*mockFileInfo, error) {
-	if info.mode&os.ModeSymlink == 0 {
-		return info, nil
+// unlink removes the directory entry fileName from dirInfo.
+func (fs *mockFileSystem) unlink(dirInfo *mockInode, fileName string) {
+	dirInfo = fs.own(dirInfo)
+	info := fs.own(dirInfo.children[fileName])
+	now := fs.now()
+	delete(dirInfo.children, fileName)
+	dirInfo.modified(now)
+	info.nlink--
+	if info.isDir() {
+		// For the directory's "." and "..".
+		info.nlink--
+		dirInfo.nlink--
 	}
-	return fs.find(string(info.data))
+	info.changed(now)
+	info.release()
 }
 
-func (fs *mockFileSystem) findDir(op string, path string) (*mockFileInfo, error) {
-	info, err := fs.find(path)
+// lookup is walk, with errors reported against path.
+func (fs *mockFileSystem) lookup(op string, path string, follow bool) (*mockInode, string, *mockInode, error) {
+	dirInfo, fileName, info, err := fs.walk(path, follow)
 	if err != nil {
-		return nil, &os.PathError{
+		return nil, "", nil, &os.PathError{
 			Op:   op,
 			Err:  err,
 			Path: path,
 		}
 	}
-	if !info.IsDir() {
+	return dirInfo, fileName, info, nil
+}
+
+// stat finds an existing file, following symlinks.
+func (fs *mockFileSystem) stat(op string, name string) (*mockInode, error) {
+	_, _, info, err := fs.lookup(op, name, true)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
 		return nil, &os.PathError{
 			Op:   op,
-			Err:  errors.New("not a directory"),
-			Path: path,
+			Err:  syscall.ENOENT,
+			Path: name,
 		}
 	}
 	return info, nil
 }
 
-func (fs *mockFileSystem) stat(name string) (*mockFileInfo, error) {
-	info, err := fs.find(fs.abs(name))
+// lstat finds an existing file, without following a symlink in the last
+// component.
+func (fs *mockFileSystem) lstat(op string, name string) (*mockInode, error) {
+	_, _, info, err := fs.lookup(op, name, false)
 	if err != nil {
+		return nil, err
+	}
+	if info == nil {
 		return nil, &os.PathError{
-			Op:   "stat",
-			Err:  err,
+			Op:   op,
+			Err:  syscall.ENOENT,
 			Path: name,
 		}
 	}
 	return info, nil
 }
 
+// checkCreate checks whether a new entry can be added to dirInfo.
+func (fs *mockFileSystem) checkCreate(op string, path string, dirInfo *mockInode) error {
+	if dirInfo.nlink == 0 {
+		// The directory has been removed.
+		return &os.PathError{
+			Op:   op,
+			Err:  syscall.ENOENT,
+			Path: path,
+		}
+	}
+	return fs.checkAccess(op, path, dirInfo, accessWrite|accessExec)
+}
+
 func (fs *mockFileSystem) Stat(name string) (os.FileInfo, error) {
-	return fs.stat(name)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	info, err := fs.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info.info(filepath.Base(name)), nil
 }
 
 func (fs *mockFileSystem) Getwd() (string, error) {
-	return fs.cwd, nil
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	path, err := fs.dirPath(fs.current(fs.cwd))
+	if err != nil {
+		return "", os.NewSyscallError("getwd", err)
+	}
+	return path, nil
 }
 
 func (fs *mockFileSystem) Chdir(dir string) error {
-	abs := fs.abs(dir)
-	_, err := fs.findDir("chdir", abs)
-	if err == nil {
-		fs.cwd = abs
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.stat("chdir", dir)
+	if err != nil {
+		return err
+	}
+	if !info.isDir() {
+		return &os.PathError{
+			Op:   "chdir",
+			Err:  syscall.ENOTDIR,
+			Path: dir,
+		}
 	}
-	return err
+	if err := fs.checkAccess("chdir", dir, info, accessExec); err != nil {
+		return err
+	}
+	fs.cwd = info
+	return nil
 }
 
 func (fs *mockFileSystem) Abs(path string) (string, error) {
-	return fs.abs(path), nil
+	if strings.HasPrefix(path, "/") {
+		return filepath.Clean(path), nil
+	}
+	wd, err := fs.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(wd, path), nil
 }
 
 func (fs *mockFileSystem) Chmod(name string, mode os.FileMode) error {
-	info, err := fs.stat(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.stat("chmod", name)
 	if err != nil {
 		return err
 	}
-	f := mockFile{info: info}
-	return f.Chmod(mode)
+	return fs.chmod("chmod", name, info, mode)
 }
 
-func (fs *mockFileSystem) lstat(name string) (*mockFileInfo, error) {
-	dirPath, fileName := fs.splitAbs(name)
-	dirInfo, err := fs.findDir("lstat", dirPath)
+func (fs *mockFileSystem) Chown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	info, err := fs.stat("chown", name)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return fs.chown("chown", name, info, uid, gid)
+}
 
-	info := dirInfo.children[fileName]
-	if info == nil {
-		return nil, &os.PathError{
-			Op:   "lstat",
-			Err:  os.ErrNotExist,
-			Path: name,
-		}
-	}
+func (fs *mockFileSystem) Lchown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-	return info, nil
+	info, err := fs.lstat("lchown", name)
+	if err != nil {
+		return err
+	}
+	return fs.chown("lchown", name, info, uid, gid)
 }
 
 func (fs *mockFileSystem) Lstat(name string) (os.FileInfo, error) {
-	return fs.lstat(name)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	info, err := fs.lstat("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info.info(filepath.Base(name)), nil
 }
 
 func (fs *mockFileSystem) Readlink(name string) (string, error) {
-	info, err := fs.lstat(name)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	info, err := fs.lstat("readlink", name)
 	if err != nil {
 		return "", err
 	}
-	if info.mode&os.ModeSymlink == 0 {
+	if !info.isSymlink() {
 		return "", &os.PathError{
 			Op:   "readlink",
-			Err:  errors.New("not a symlink"),
+			Err:  syscall.EINVAL,
 			Path: name,
 		}
 	}
@@ -179,102 +354,100 @@ func (fs *mockFileSystem) Readlink(name string) (string, error) {
 }
 
 func (fs *mockFileSystem) Symlink(oldname, newname string) error {
-	dirPath, fileName := fs.splitAbs(newname)
-	dirInfo, err := fs.findDir("symlink", dirPath)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.symlink(oldname, newname); err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	return nil
+}
+
+func (fs *mockFileSystem) symlink(oldname, newname string) error {
+	if len(oldname) >= maxPath {
+		return syscall.ENAMETOOLONG
+	}
+	dirInfo, fileName, info, err := fs.walk(newname, false)
 	if err != nil {
 		return err
 	}
-
-	info := dirInfo.children[fileName]
 	if info != nil {
-		return &os.PathError{
-			Op:   "symlink",
-			Err:  os.ErrExist,
-			Path: newname,
-		}
+		return syscall.EEXIST
 	}
-
-	info = &mockFileInfo{
-		name:     fileName,
-		mode:     os.ModeSymlink | os.FileMode(0777),
-		parent:   dirInfo,
-		children: nil,
-		data:     []byte(fs.abs(oldname)),
+	if err := fs.checkCreate("symlink", newname, dirInfo); err != nil {
+		return err
 	}
 
-	dirInfo.children[fileName] = info
+	// The target is stored exactly as given, and only resolved when the link
+	// is followed.
+	info = fs.newInode(dirInfo, os.ModeSymlink|os.FileMode(0777))
+	info.data = []byte(oldname)
+	fs.link(dirInfo, fileName, info)
 	return nil
 }
 
-func (fs *mockFileSystem) Mkdir(path string, perm os.FileMode) error {
-	dirPath, fileName := fs.splitAbs(path)
-	dirInfo, err := fs.findDir("mkdir", dirPath)
+func (fs *mockFileSystem) Link(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.hardLink(oldname, newname); err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	return nil
+}
+
+func (fs *mockFileSystem) hardLink(oldname, newname string) error {
+	// Hard links don't follow a symlink in oldname; they link to the symlink
+	// itself.
+	info, err := fs.lstat("link", oldname)
 	if err != nil {
 		return err
 	}
-
-	info := dirInfo.children[fileName]
-	if info != nil {
-		if info.IsDir() {
-			// Already exists.
-			return nil
-		}
-		return &os.PathError{
-			Op:   "mkdir",
-			Err:  errors.New("exists but not a directory"),
-			Path: path,
-		}
+	if info.isDir() {
+		return syscall.EPERM
 	}
 
-	info = &mockFileInfo{
-		name:     fileName,
-		mode:     os.ModeDir | (perm & os.ModePerm),
-		parent:   dirInfo,
-		children: make(map[string]*mockFileInfo),
-		data:     nil,
+	dirInfo, fileName, existing, err := fs.walk(newname, false)
+	if err != nil {
+		return err
 	}
-	dirInfo.children[fileName] = info
+	if existing != nil {
+		return syscall.EEXIST
+	}
+	if err := fs.checkCreate("link", newname, dirInfo); err != nil {
+		return err
+	}
+
+	fs.link(dirInfo, fileName, info)
 	return nil
 }
 
-func (fs *mockFileSystem) doMkdirAll(path string, perm os.FileMode) (*mockFileInfo, error) {
-	if path == "" || path == "/" {
-		return &fs.root, nil
-	}
+func (fs *mockFileSystem) Mkdir(path string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-	dirPath, fileName := split(path)
-	dirInfo, err := fs.doMkdirAll(dirPath, perm)
+	dirInfo, fileName, info, err := fs.lookup("mkdir", path, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	info := dirInfo.children[fileName]
 	if info != nil {
-		if info.IsDir() {
-			// Already exists and is a dir.
-			return info, nil
-		}
-		return nil, &os.PathError{
-			Op:   "mkdirall",
-			Err:  errors.New("exists but not a directory"),
+		return &os.PathError{
+			Op:   "mkdir",
+			Err:  syscall.EEXIST,
 			Path: path,
 		}
 	}
-
-	info = &mockFileInfo{
-		name:     fileName,
-		mode:     os.ModeDir | (perm & os.ModePerm),
-		parent:   dirInfo,
-		children: make(map[string]*mockFileInfo),
-		data:     nil,
+	if err := fs.checkCreate("mkdir", path, dirInfo); err != nil {
+		return err
 	}
-	dirInfo.children[fileName] = info
-	return info, nil
+
+	fs.link(dirInfo, fileName, fs.newInode(dirInfo, os.ModeDir|(perm&os.ModePerm)))
+	return nil
 }
 
 func (fs *mockFileSystem) MkdirAll(path string, perm os.FileMode) error {
-	_, err := fs.doMkdirAll(fs.abs(path), perm)
-	return err
+	return mkdirAll(fs, path, perm)
 }
 
 func (fs *mockFileSystem) Open(name string) (File, error) {
@@ -286,181 +459,405 @@ func (fs *mockFileSystem) Create(name string) (File, error) {
 }
 
 func (fs *mockFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
-	var info *mockFileInfo
-	var err error
-	abs := fs.abs(name)
-
-	if flag&os.O_CREATE == 0 {
-		// The file must already exist.
-		info, err = fs.find(abs)
-		if err != nil {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Symlinks are followed, even when they dangle, so that O_CREATE makes
+	// the file they point to. The exceptions are O_NOFOLLOW, and O_EXCL,
+	// where the link itself counts as an existing file.
+	exclusive := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+	follow := flag&oNoFollow == 0 && !exclusive
+
+	dirInfo, fileName, info, err := fs.lookup("open", name, follow)
+	if err != nil {
+		return nil, err
+	}
+
+	created := false
+	if info == nil {
+		if flag&os.O_CREATE == 0 {
 			return nil, &os.PathError{
-				Op:   "openfile",
-				Err:  err,
+				Op:   "open",
+				Err:  syscall.ENOENT,
 				Path: name,
 			}
 		}
-	} else {
-		// We can create the file if needed.
-		dirPath, fileName := split(abs)
-		dirInfo, err := fs.findDir("openfile", dirPath)
-		if err != nil {
+		if strings.HasSuffix(name, "/") {
+			// Only directories can have a trailing slash, and open can't
+			// create those.
+			return nil, &os.PathError{
+				Op:   "open",
+				Err:  syscall.EISDIR,
+				Path: name,
+			}
+		}
+		// Create a new one.
+		if err := fs.checkCreate("open", name, dirInfo); err != nil {
 			return nil, err
 		}
-
-		info = dirInfo.children[fileName]
-		if info == nil {
-			// Create a new one.
-			info = &mockFileInfo{
-				name:     fileName,
-				mode:     (perm & os.ModePerm),
-				parent:   dirInfo,
-				children: nil,
-				data:     nil,
-			}
-			dirInfo.children[fileName] = info
-		} else {
-			// It already exists.
-			if flag&os.O_EXCL == os.O_EXCL {
-				return nil, &os.PathError{
-					Op:   "openfile",
-					Err:  os.ErrExist,
-					Path: name,
-				}
+		info = fs.newInode(dirInfo, perm&os.ModePerm)
+		fs.link(dirInfo, fileName, info)
+		created = true
+	} else {
+		// It already exists.
+		if exclusive {
+			return nil, &os.PathError{
+				Op:   "open",
+				Err:  syscall.EEXIST,
+				Path: name,
 			}
-			// Handle symlinks.
-			info, err = fs.deref(info)
-			if err != nil {
-				return nil, &os.PathError{
-					Op:   "openfile",
-					Err:  err,
-					Path: name,
-				}
+		}
+		if info.isSymlink() {
+			// Only possible with O_NOFOLLOW.
+			return nil, &os.PathError{
+				Op:   "open",
+				Err:  syscall.ELOOP,
+				Path: name,
 			}
 		}
 	}
+	if flag&oDirectory != 0 && !info.isDir() {
+		return nil, &os.PathError{
+			Op:   "open",
+			Err:  syscall.ENOTDIR,
+			Path: name,
+		}
+	}
 
-	// Handle truncate and append flags.
-	if flag&os.O_TRUNC == os.O_TRUNC {
-		info.data = nil
+	// Directories can only be opened for reading.
+	if info.isDir() && (flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0) {
+		return nil, &os.PathError{
+			Op:   "open",
+			Err:  syscall.EISDIR,
+			Path: name,
+		}
+	}
+
+	// A newly created file can be opened however the caller likes, regardless
+	// of the permissions it was created with.
+	if !created {
+		if err := fs.checkAccess("open", name, info, openAccess(flag)); err != nil {
+			return nil, err
+		}
 	}
-	position := 0
-	if flag&os.O_APPEND == os.O_APPEND {
-		position = len(info.data)
+
+	info = fs.own(info)
+
+	// Handle the truncate flag; append is handled by each write.
+	if flag&os.O_TRUNC == os.O_TRUNC {
+		info.truncate(0, fs.now())
 	}
 
+	info.open++
 	return &mockFile{
-		name:     name,
-		info:     info,
-		position: position,
+		fs:    fs,
+		name:  name,
+		info:  info,
+		flag:  flag,
+		dir:   info.isDir(),
+		epoch: fs.epoch,
 	}, nil
 }
 
 func (fs *mockFileSystem) Truncate(name string, size int64) error {
-	info, err := fs.stat(name)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	info, err := fs.stat("truncate", name)
 	if err != nil {
 		return err
 	}
-	file := mockFile{info: info}
-	return file.Truncate(size)
+	if info.isDir() {
+		return &os.PathError{
+			Op:   "truncate",
+			Err:  syscall.EISDIR,
+			Path: name,
+		}
+	}
+	if err := fs.checkAccess("truncate", name, info, accessWrite); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &os.PathError{
+			Op:   "truncate",
+			Err:  syscall.EINVAL,
+			Path: name,
+		}
+	}
+	fs.own(info).truncate(size, fs.now())
+	return nil
 }
 
 func (fs *mockFileSystem) Remove(name string) error {
-	dirPath, fileName := fs.splitAbs(name)
-	dirInfo, err := fs.findDir("remove", dirPath)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Explicitly not following symlinks here; we want to delete the link.
+	dirInfo, fileName, info, err := fs.lookup("remove", name, false)
 	if err != nil {
 		return err
 	}
-
-	// Explicitly not following symlinks here; we want to delete the link.
-	info := dirInfo.children[fileName]
 	if info == nil {
 		return &os.PathError{
 			Op:   "remove",
-			Err:  os.ErrNotExist,
+			Err:  syscall.ENOENT,
+			Path: name,
+		}
+	}
+	if fileName == "." || fileName == ".." {
+		// Linux refuses to remove "." outright, and ".." is never empty.
+		err := syscall.EINVAL
+		if fileName == ".." {
+			err = syscall.ENOTEMPTY
+		}
+		return &os.PathError{
+			Op:   "remove",
+			Err:  err,
 			Path: name,
 		}
 	}
+	if err := fs.checkUnlink("remove", name, dirInfo, info); err != nil {
+		return err
+	}
 
-	if info.IsDir() && len(info.children) != 0 {
+	if info.isDir() && len(info.children) != 0 {
 		return &os.PathError{
 			Op:   "remove",
-			Err:  errors.New("directory is not empty"),
+			Err:  syscall.ENOTEMPTY,
 			Path: name,
 		}
 	}
 
-	delete(dirInfo.children, fileName)
+	fs.unlink(dirInfo, fileName)
 	return nil
 }
 
-func (fs *mockFileSystem) doRemoveAll(dirInfo *mockFileInfo, fileName string) {
+func (fs *mockFileSystem) doRemoveAll(path string, dirInfo *mockInode, fileName string) error {
+	dirInfo = fs.current(dirInfo)
 	info := dirInfo.children[fileName]
-	if info != nil {
-		if info.IsDir() {
-			for fn := range info.children {
-				fs.doRemoveAll(info, fn)
+	if info == nil {
+		return nil
+	}
+	info = fs.current(info)
+	if info.isDir() {
+		if err := fs.checkAccess("openfdat", path, info, accessRead|accessExec); err != nil {
+			return err
+		}
+		for fn := range info.children {
+			if err := fs.doRemoveAll(filepath.Join(path, fn), info, fn); err != nil {
+				return err
 			}
 		}
-		delete(info.children, fileName)
 	}
+	if err := fs.checkUnlink("unlinkat", path, dirInfo, info); err != nil {
+		return err
+	}
+	fs.unlink(dirInfo, fileName)
+	return nil
 }
 
 func (fs *mockFileSystem) RemoveAll(path string) error {
-	dirPath, fileName := fs.splitAbs(path)
-	dirInfo, err := fs.find(dirPath)
-	if err == nil && dirInfo.IsDir() {
-		fs.doRemoveAll(dirInfo, fileName)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	dirInfo, fileName, info, err := fs.walk(path, false)
+	if fileName == "." || fileName == ".." {
+		return &os.PathError{
+			Op:   "RemoveAll",
+			Err:  syscall.EINVAL,
+			Path: path,
+		}
 	}
-	return nil
+	if errors.Is(err, syscall.ENOENT) || (err == nil && info == nil) {
+		// Like os.RemoveAll, it's fine if there's nothing to remove.
+		return nil
+	}
+	if err != nil {
+		return &os.PathError{
+			Op:   "RemoveAll",
+			Err:  err,
+			Path: path,
+		}
+	}
+	return fs.doRemoveAll(path, dirInfo, fileName)
 }
 
 func (fs *mockFileSystem) Rename(oldpath, newpath string) error {
-	oldDirPath, oldFileName := fs.splitAbs(oldpath)
-	newDirPath, newFileName := fs.splitAbs(newpath)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-	oldDirInfo, err := fs.findDir("rename", oldDirPath)
+	if err := fs.rename(oldpath, newpath); err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	return nil
+}
+
+func (fs *mockFileSystem) rename(oldpath, newpath string) error {
+	oldDirInfo, oldFileName, info, err := fs.walk(oldpath, false)
 	if err != nil {
 		return err
 	}
-
-	info := oldDirInfo.children[oldFileName]
 	if info == nil {
-		return &os.PathError{
-			Op:   "rename",
-			Err:  os.ErrNotExist,
-			Path: oldpath,
+		return syscall.ENOENT
+	}
+
+	newDirInfo, newFileName, target, err := fs.walk(newpath, false)
+	if err != nil {
+		return err
+	}
+	if target != nil && target.isDir() && (target != info || oldpath == newpath) {
+		// Like os.Rename, never replace a directory.
+		return syscall.EEXIST
+	}
+	for _, name := range []string{oldFileName, newFileName} {
+		if name == "." || name == ".." {
+			return syscall.EINVAL
 		}
 	}
 
-	newDirInfo := oldDirInfo
-	if oldDirPath != newDirPath {
-		newDirInfo, err = fs.findDir("rename", newDirPath)
-		if err != nil {
+	if err := fs.checkUnlink("rename", oldpath, oldDirInfo, info); err != nil {
+		return err
+	}
+	if err := fs.checkCreate("rename", newpath, newDirInfo); err != nil {
+		return err
+	}
+	if target != nil {
+		if err := fs.checkUnlink("rename", newpath, newDirInfo, target); err != nil {
 			return err
 		}
 	}
+	if info.isDir() && newDirInfo != oldDirInfo {
+		// Moving a directory rewrites its ".." entry.
+		if err := fs.checkAccess("rename", oldpath, info, accessWrite); err != nil {
+			return err
+		}
+	}
+	if target == info {
+		// Both names are links to the same file, so there's nothing to do.
+		return nil
+	}
+	if target != nil && info.isDir() {
+		// A directory can only replace another directory.
+		return syscall.ENOTDIR
+	}
+	if info.isDir() {
+		// A directory can't be moved inside itself.
+		for dir := newDirInfo; dir.ino != fs.root.ino; dir = fs.current(dir.parent) {
+			if dir == info {
+				return syscall.EINVAL
+			}
+		}
+	}
 
+	// Anyone with the target open keeps seeing its old contents; it's only
+	// freed once they close it.
+	if target != nil {
+		fs.unlink(newDirInfo, newFileName)
+	}
+	oldDirInfo = fs.own(oldDirInfo)
+	newDirInfo = fs.own(newDirInfo)
+	info = fs.own(info)
+	now := fs.now()
 	delete(oldDirInfo.children, oldFileName)
-	info.name = newFileName
-	info.parent = newDirInfo
+	oldDirInfo.modified(now)
 	newDirInfo.children[newFileName] = info
+	newDirInfo.modified(now)
+	if info.isDir() {
+		// Move the directory's "..".
+		oldDirInfo.nlink--
+		newDirInfo.nlink++
+		info.parent = newDirInfo
+	}
+	info.changed(now)
+	return nil
+}
+
+func (fs *mockFileSystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	info, err := fs.stat("chtimes", name)
+	if err != nil {
+		return err
+	}
+	if err := fs.checkOwner("chtimes", name, info); err != nil {
+		return err
+	}
+	// A zero time.Time leaves the corresponding time unchanged, as with
+	// os.Chtimes.
+	fs.own(info).setTimes(atime, mtime, fs.now())
 	return nil
 }
 
-func dump(prefix string, info *mockFileInfo) {
-	for _, child := range info.children {
-		if child.IsDir() {
-			name := prefix + child.name + "/"
+// list returns the names in dirInfo, in the order Readdir hands them out.
+func (fs *mockFileSystem) list(dirInfo *mockInode) []string {
+	names := make([]string, 0, len(dirInfo.children))
+	for name := range dirInfo.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if fs.shuffle {
+		// Each directory gets its own order, but always the same one.
+		r := rand.New(rand.NewPCG(fs.seed, dirInfo.ino))
+		r.Shuffle(len(names), func(i, j int) {
+			names[i], names[j] = names[j], names[i]
+		})
+	}
+	return names
+}
+
+// linkError converts an error from an operation on two paths into the
+// *os.LinkError that the os package would return.
+func linkError(op string, oldname, newname string, err error) error {
+	var pe *os.PathError
+	var le *os.LinkError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	} else if errors.As(err, &le) {
+		err = le.Err
+	}
+	return &os.LinkError{
+		Op:  op,
+		Old: oldname,
+		New: newname,
+		Err: err,
+	}
+}
+
+// openAccess returns the access bits needed to open a file with flag.
+func openAccess(flag int) os.FileMode {
+	var want os.FileMode
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		want = accessRead
+	case os.O_WRONLY:
+		want = accessWrite
+	case os.O_RDWR:
+		want = accessRead | accessWrite
+	}
+	if flag&os.O_TRUNC == os.O_TRUNC {
+		want |= accessWrite
+	}
+	return want
+}
+
+func (fs *mockFileSystem) dump(prefix string, info *mockInode) {
+	for _, name := range fs.list(info) {
+		child := fs.current(info.children[name])
+		if child.isDir() {
+			name := prefix + name + "/"
 			fmt.Println(name)
-			dump(name, child)
+			fs.dump(name, child)
 		} else {
-			fmt.Println(prefix + child.name)
+			fmt.Println(prefix + name)
 		}
 	}
 }
 
 func (fs *mockFileSystem) Dump() {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
 	fmt.Println("/")
-	dump("/", &fs.root)
+	fs.dump("/", fs.current(fs.root))
 }
@@ -0,0 +1,237 @@
+package gofs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The number of goroutines each stress test runs at once.
+const stressWorkers = 16
+
+// stress runs f on stressWorkers goroutines at once, and waits for them all.
+func stress(f func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < stressWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcurrency(t *testing.T) {
+	t.Run("Exclusive", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+		for round := 0; round < 50; round++ {
+			name := fmt.Sprintf("/file%v", round)
+			var winners int32
+			stress(func(i int) {
+				f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(0644))
+				if err == nil {
+					atomic.AddInt32(&winners, 1)
+					f.Close()
+				} else if !errors.Is(err, os.ErrExist) {
+					t.Errorf("Unexpected error from OpenFile: %v", err)
+				}
+			})
+			if winners != 1 {
+				t.Fatalf("Expected one winner, got %v", winners)
+			}
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+		WriteFile(fs, "/target", []byte("original"), os.FileMode(0644))
+
+		// Readers must always see either the old file or a new one, never
+		// nothing.
+		stress(func(i int) {
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					tmp := fmt.Sprintf("/tmp%v", i)
+					WriteFile(fs, tmp, []byte(tmp), os.FileMode(0644))
+					if err := fs.Rename(tmp, "/target"); err != nil {
+						t.Errorf("Unexpected error from Rename: %v", err)
+					}
+				} else if _, err := ReadFile(fs, "/target"); err != nil {
+					t.Errorf("Unexpected error from ReadFile: %v", err)
+				}
+			}
+		})
+	})
+
+	t.Run("Tree", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+
+		stress(func(i int) {
+			dir := fmt.Sprintf("/dir%v", i%4)
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("%v/sub%v/file%v", dir, j%3, i)
+				fs.MkdirAll(filepath.Dir(name), os.FileMode(0755))
+				WriteFile(fs, name, []byte(name), os.FileMode(0644))
+				fs.Symlink(name, name+".link")
+				fs.Link(name, name+".hard")
+				ReadDir(fs, dir)
+				fs.Stat(name + ".link")
+				fs.Chmod(name, os.FileMode(0600))
+				fs.Chtimes(name, time.Now(), time.Now())
+				if j%10 == 9 {
+					fs.RemoveAll(dir)
+				} else {
+					fs.Remove(name + ".hard")
+				}
+			}
+		})
+	})
+
+	t.Run("SharedFile", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+		f, err := fs.OpenFile("/file", os.O_RDWR|os.O_CREATE|os.O_APPEND, os.FileMode(0644))
+		if err != nil {
+			t.Fatalf("Unexpected error from OpenFile: %v", err)
+		}
+
+		// Appends through one handle never interleave or get lost.
+		stress(func(i int) {
+			for j := 0; j < 100; j++ {
+				f.Write([]byte("0123456789"))
+				f.Stat()
+				f.Seek(0, io.SeekStart)
+			}
+		})
+		f.Close()
+
+		data, _ := ReadFile(fs, "/file")
+		if len(data) != stressWorkers*100*10 {
+			t.Fatalf("Unexpected size: %v", len(data))
+		}
+		for i := 0; i < len(data); i += 10 {
+			if string(data[i:i+10]) != "0123456789" {
+				t.Fatalf("Interleaved write at %v: '%v'", i, string(data[i:i+10]))
+			}
+		}
+	})
+
+	t.Run("SeparateHandles", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+		WriteFile(fs, "/file", nil, os.FileMode(0644))
+
+		stress(func(i int) {
+			f, err := fs.OpenFile("/file", os.O_RDWR, 0)
+			if err != nil {
+				t.Errorf("Unexpected error from OpenFile: %v", err)
+				return
+			}
+			defer f.Close()
+			for j := 0; j < 100; j++ {
+				f.Write([]byte{byte(i)})
+				f.Read(make([]byte, 4))
+				f.Truncate(int64(j))
+				f.Readdir(-1)
+			}
+		})
+	})
+
+	t.Run("ReadAt", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+		WriteFile(fs, "/file", []byte("0123456789"), os.FileMode(0644))
+		f, err := fs.Open("/file")
+		if err != nil {
+			t.Fatalf("Unexpected error from Open: %v", err)
+		}
+
+		// Positional reads don't wait for whoever has the position.
+		mf := f.(*mockFile)
+		mf.mu.Lock()
+		done := make(chan error)
+		go func() {
+			_, err := f.ReadAt(make([]byte, 4), 3)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Unexpected error from ReadAt: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("ReadAt waited for the file's lock")
+		}
+		mf.mu.Unlock()
+		if t.Failed() {
+			return
+		}
+
+		stress(func(i int) {
+			b := make([]byte, 4)
+			for j := 0; j < 100; j++ {
+				if i%2 == 0 {
+					if n, err := f.ReadAt(b, 3); n != 4 || err != nil || string(b) != "3456" {
+						t.Errorf("Unexpected read result: '%v', %v", string(b[:n]), err)
+						return
+					}
+				} else {
+					f.Read(b)
+					f.Seek(0, io.SeekStart)
+				}
+			}
+		})
+		f.Close()
+		if _, err := f.ReadAt(make([]byte, 4), 3); !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("Expected ErrClosed, got '%v'", err)
+		}
+	})
+
+	t.Run("RemoveWhileOpen", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+
+		stress(func(i int) {
+			name := fmt.Sprintf("/file%v", i%2)
+			for j := 0; j < 100; j++ {
+				f, err := fs.Create(name)
+				if err != nil {
+					t.Errorf("Unexpected error from Create: %v", err)
+					return
+				}
+				fs.Remove(name)
+				f.Write([]byte("data"))
+				f.Close()
+			}
+		})
+	})
+
+	t.Run("Chdir", func(t *testing.T) {
+		t.Parallel()
+		fs := MockFs()
+		fs.MkdirAll("/a/b", os.FileMode(0755))
+
+		stress(func(i int) {
+			for j := 0; j < 100; j++ {
+				if i%2 == 0 {
+					fs.Chdir("/a")
+					fs.Chdir("/a/b")
+				} else {
+					fs.Getwd()
+					fs.Abs("file")
+					fs.Stat("b")
+				}
+			}
+		})
+	})
+}
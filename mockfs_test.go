@@ -1,10 +1,14 @@
 package gofs
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func testFileExists(t *testing.T, fs FileSystem, file string, expected bool) {
@@ -137,3 +141,534 @@ func TestOpen(t *testing.T) {
 		}
 	})
 }
+
+func readdirnames(t *testing.T, fs FileSystem, dir string) string {
+	f, err := fs.Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error from Open: %v", err)
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		t.Fatalf("Unexpected error from Readdirnames: %v", err)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestDirOrder(t *testing.T) {
+	populate := func(fs FileSystem) {
+		fs.MkdirAll("/a", os.FileMode(0755))
+		fs.MkdirAll("/b", os.FileMode(0755))
+		for _, name := range []string{"c", "a", "e", "b", "d", "f", "h", "g"} {
+			WriteFile(fs, "/a/"+name, nil, os.FileMode(0644))
+			WriteFile(fs, "/b/"+name, nil, os.FileMode(0644))
+		}
+	}
+
+	t.Run("Sorted", func(t *testing.T) {
+		fs := MockFs()
+		populate(fs)
+		if names := readdirnames(t, fs, "/a"); names != "a,b,c,d,e,f,g,h" {
+			t.Fatalf("Unexpected order: %v", names)
+		}
+	})
+
+	t.Run("Shuffled", func(t *testing.T) {
+		fs := MockFs(WithShuffledDirs(42))
+		populate(fs)
+		a := readdirnames(t, fs, "/a")
+		b := readdirnames(t, fs, "/b")
+		if a == "a,b,c,d,e,f,g,h" || b == "a,b,c,d,e,f,g,h" || a == b {
+			t.Fatalf("Expected different orders, got %v and %v", a, b)
+		}
+		if again := readdirnames(t, fs, "/a"); again != a {
+			t.Fatalf("Order changed from %v to %v", a, again)
+		}
+
+		other := MockFs(WithShuffledDirs(42))
+		populate(other)
+		if names := readdirnames(t, other, "/a"); names != a {
+			t.Fatalf("Same seed gave %v and %v", a, names)
+		}
+	})
+}
+
+func TestTimes(t *testing.T) {
+	fs := MockFs()
+	before := time.Now()
+	fs.Mkdir("/foo", os.FileMode(0755))
+	WriteFile(fs, "/foo/hello", []byte("Hello World"), os.FileMode(0644))
+
+	t.Run("Create", func(t *testing.T) {
+		info, err := fs.Stat("/foo/hello")
+		if err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		if info.ModTime().Before(before) {
+			t.Fatalf("Unexpected mod time: %v is before %v", info.ModTime(), before)
+		}
+	})
+
+	t.Run("Chtimes", func(t *testing.T) {
+		mtime := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+		if err := fs.Chtimes("/foo/hello", time.Time{}, mtime); err != nil {
+			t.Fatalf("Unexpected error from Chtimes: %v", err)
+		}
+		info, _ := fs.Stat("/foo/hello")
+		if !info.ModTime().Equal(mtime) {
+			t.Fatalf("Unexpected mod time: expected %v was %v", mtime, info.ModTime())
+		}
+
+		before := time.Now()
+		f, _ := fs.OpenFile("/foo/hello", os.O_WRONLY|os.O_APPEND, 0)
+		f.Write([]byte("!"))
+		f.Close()
+		info, _ = fs.Stat("/foo/hello")
+		if info.ModTime().Before(before) {
+			t.Fatalf("Write did not update mod time: %v", info.ModTime())
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		old := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+		fs.Chtimes("/foo", old, old)
+		if err := fs.Rename("/foo/hello", "/foo/bye"); err != nil {
+			t.Fatalf("Unexpected error from Rename: %v", err)
+		}
+		info, _ := fs.Stat("/foo")
+		if !info.ModTime().After(old) {
+			t.Fatalf("Rename did not update directory mod time: %v", info.ModTime())
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		err := fs.Chtimes("/bogus", time.Now(), time.Now())
+		if !os.IsNotExist(err) {
+			t.Fatalf("Expected not exist, got '%v'", err)
+		}
+	})
+}
+
+func testModTime(t *testing.T, fs FileSystem, path string, expected time.Time) {
+	t.Helper()
+	info, err := fs.Stat(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from Stat: %v", err)
+	}
+	if !info.ModTime().Equal(expected) {
+		t.Fatalf("Unexpected mod time for %v: expected %v was %v", path, expected, info.ModTime())
+	}
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	clock := NewManualClock(start)
+	fs := MockFs(WithClock(clock))
+	testModTime(t, fs, "/", start)
+
+	clock.Advance(time.Minute)
+	fs.Mkdir("/foo", os.FileMode(0755))
+	testModTime(t, fs, "/", start.Add(time.Minute))
+	testModTime(t, fs, "/foo", start.Add(time.Minute))
+
+	clock.Advance(time.Minute)
+	f, _ := fs.Create("/foo/hello")
+	testModTime(t, fs, "/foo", start.Add(2*time.Minute))
+	testModTime(t, fs, "/foo/hello", start.Add(2*time.Minute))
+
+	clock.Advance(time.Hour)
+	f.Write([]byte("Hello World"))
+	testModTime(t, fs, "/foo/hello", start.Add(time.Hour+2*time.Minute))
+	testModTime(t, fs, "/foo", start.Add(2*time.Minute))
+
+	clock.Advance(time.Hour)
+	f.Truncate(5)
+	f.Close()
+	testModTime(t, fs, "/foo/hello", start.Add(2*time.Hour+2*time.Minute))
+
+	clock.Set(start)
+	fs.Remove("/foo/hello")
+	testModTime(t, fs, "/foo", start)
+}
+
+func testPermission(t *testing.T, name string, err error, expected bool) {
+	t.Run(name, func(t *testing.T) {
+		if expected && !os.IsPermission(err) {
+			t.Fatalf("Expected a permission error, got '%v'", err)
+		}
+		if !expected && err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func TestPermissions(t *testing.T) {
+	fs := MockFs(WithIdentity(0, 0))
+	fs.MkdirAll("/home/alice", os.FileMode(0755))
+	fs.Mkdir("/tmp", os.FileMode(0777)|os.ModeSticky)
+	fs.Chmod("/tmp", os.FileMode(0777)|os.ModeSticky)
+	WriteFile(fs, "/home/alice/secret", []byte("secret"), os.FileMode(0600))
+	WriteFile(fs, "/home/alice/public", []byte("public"), os.FileMode(0644))
+	WriteFile(fs, "/home/alice/group", []byte("group"), os.FileMode(0640))
+	WriteFile(fs, "/tmp/roots", []byte("root's"), os.FileMode(0666))
+	fs.Mkdir("/home/alice/locked", os.FileMode(0700))
+	WriteFile(fs, "/home/alice/locked/file", []byte("locked"), os.FileMode(0644))
+
+	// Hand everything to alice (uid 1000), except /home/alice/group which
+	// stays with root in group 100.
+	for _, path := range []string{"/home/alice", "/home/alice/secret", "/home/alice/public", "/home/alice/locked", "/home/alice/locked/file"} {
+		fs.Chown(path, 1000, 1000)
+	}
+	fs.Chown("/home/alice/group", -1, 100)
+
+	open := func(path string, flag int) error {
+		f, err := fs.OpenFile(path, flag, os.FileMode(0644))
+		if err == nil {
+			f.Close()
+		}
+		return err
+	}
+
+	t.Run("Alice", func(t *testing.T) {
+		fs.(IdentityFs).SetIdentity(1000, 1000)
+
+		testPermission(t, "Read secret", open("/home/alice/secret", os.O_RDONLY), false)
+		testPermission(t, "Create", open("/home/alice/new", os.O_RDWR|os.O_CREATE), false)
+		testPermission(t, "Read group", open("/home/alice/group", os.O_RDONLY), true)
+		testPermission(t, "Remove roots", fs.Remove("/tmp/roots"), true)
+		testPermission(t, "Chmod secret", fs.Chmod("/home/alice/secret", os.FileMode(0400)), false)
+		testPermission(t, "Write read-only", open("/home/alice/secret", os.O_WRONLY), true)
+		testPermission(t, "Truncate read-only", open("/home/alice/secret", os.O_RDONLY|os.O_TRUNC), true)
+		testPermission(t, "Chown give away", fs.Chown("/home/alice/public", 1001, -1), true)
+		testPermission(t, "Chown foreign group", fs.Chown("/home/alice/public", -1, 100), true)
+		testPermission(t, "Chown own group", fs.Chown("/home/alice/public", 1000, 1000), false)
+	})
+
+	t.Run("Bob", func(t *testing.T) {
+		fs.(IdentityFs).SetIdentity(1001, 1001, 100)
+
+		testPermission(t, "Read secret", open("/home/alice/secret", os.O_RDONLY), true)
+		testPermission(t, "Read public", open("/home/alice/public", os.O_RDONLY), false)
+		testPermission(t, "Write public", open("/home/alice/public", os.O_WRONLY), true)
+		testPermission(t, "Read group", open("/home/alice/group", os.O_RDONLY), false)
+		testPermission(t, "Create", open("/home/alice/bobs", os.O_RDWR|os.O_CREATE), true)
+		testPermission(t, "Mkdir", fs.Mkdir("/home/alice/bobs", os.FileMode(0755)), true)
+		testPermission(t, "Remove", fs.Remove("/home/alice/public"), true)
+		testPermission(t, "Rename", fs.Rename("/home/alice/public", "/tmp/public"), true)
+		testPermission(t, "Readdir locked", open("/home/alice/locked", os.O_RDONLY), true)
+		_, err := fs.Stat("/home/alice/locked/file")
+		testPermission(t, "Traverse locked", err, true)
+		testPermission(t, "RemoveAll in locked", fs.RemoveAll("/home/alice/locked/file"), true)
+		testPermission(t, "Chmod public", fs.Chmod("/home/alice/public", os.FileMode(0777)), true)
+		testPermission(t, "Chtimes public", fs.Chtimes("/home/alice/public", time.Now(), time.Now()), true)
+
+		testPermission(t, "Create in tmp", open("/tmp/bobs", os.O_RDWR|os.O_CREATE), false)
+		testPermission(t, "Remove roots", fs.Remove("/tmp/roots"), true)
+		testPermission(t, "Remove own", fs.Remove("/tmp/bobs"), false)
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		fs.(IdentityFs).SetIdentity(0, 0)
+
+		testPermission(t, "Read secret", open("/home/alice/secret", os.O_RDWR), false)
+		testPermission(t, "Remove roots", fs.Remove("/tmp/roots"), false)
+		testPermission(t, "RemoveAll", fs.RemoveAll("/home/alice"), false)
+	})
+}
+
+func testNlink(t *testing.T, fs FileSystem, path string, expected uint64) {
+	t.Helper()
+	info, err := fs.Lstat(path)
+	if err != nil {
+		t.Fatalf("Unexpected error from Lstat: %v", err)
+	}
+	if nlink := info.(*mockFileInfo).nlink; nlink != expected {
+		t.Fatalf("Unexpected nlink for %v: expected %v was %v", path, expected, nlink)
+	}
+}
+
+func TestLink(t *testing.T) {
+	fs := MockFs()
+	fs.MkdirAll("/foo/bar", os.FileMode(0755))
+	fs.Mkdir("/baz", os.FileMode(0755))
+	WriteFile(fs, "/foo/hello", []byte("Hello World"), os.FileMode(0644))
+
+	testNlink(t, fs, "/", 4)
+	testNlink(t, fs, "/foo", 3)
+	testNlink(t, fs, "/foo/bar", 2)
+
+	if err := fs.Link("/foo/hello", "/baz/hello"); err != nil {
+		t.Fatalf("Unexpected error from Link: %v", err)
+	}
+	testNlink(t, fs, "/foo/hello", 2)
+
+	t.Run("Shared", func(t *testing.T) {
+		WriteFile(fs, "/baz/hello", []byte("Goodbye"), os.FileMode(0644))
+		data, _ := ReadFile(fs, "/foo/hello")
+		if string(data) != "Goodbye" {
+			t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+		a, _ := fs.Stat("/foo/hello")
+		b, _ := fs.Stat("/baz/hello")
+		if a.(*mockFileInfo).ino != b.(*mockFileInfo).ino {
+			t.Fatalf("Links have different inodes")
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if err := fs.Link("/foo/hello", "/baz/hello"); !os.IsExist(err) {
+			t.Fatalf("Expected exists, got '%v'", err)
+		}
+		if err := fs.Link("/foo/bar", "/baz/bar"); err == nil {
+			t.Fatalf("Expected an error linking a directory, got nil")
+		}
+		if err := fs.Link("/foo/bogus", "/baz/bogus"); !os.IsNotExist(err) {
+			t.Fatalf("Expected not exist, got '%v'", err)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		f, _ := fs.Open("/baz/hello")
+		defer f.Close()
+
+		fs.Remove("/foo/hello")
+		testNlink(t, fs, "/baz/hello", 1)
+		fs.Remove("/baz/hello")
+
+		info, _ := f.Stat()
+		if nlink := info.(*mockFileInfo).nlink; nlink != 0 {
+			t.Fatalf("Unexpected nlink: %v", nlink)
+		}
+		data, err := io.ReadAll(f)
+		if err != nil || string(data) != "Goodbye" {
+			t.Fatalf("Unexpected read result: '%v', %v", string(data), err)
+		}
+	})
+
+	t.Run("Dirs", func(t *testing.T) {
+		fs.Rename("/foo/bar", "/baz/bar")
+		testNlink(t, fs, "/foo", 2)
+		testNlink(t, fs, "/baz", 3)
+		fs.RemoveAll("/baz")
+		testNlink(t, fs, "/", 3)
+	})
+}
+
+func TestUnlinkWhileOpen(t *testing.T) {
+	fs := MockFs()
+	fs.Mkdir("/log", os.FileMode(0755))
+	WriteFile(fs, "/log/app.log", []byte("old\n"), os.FileMode(0644))
+
+	t.Run("Rotate", func(t *testing.T) {
+		w, _ := fs.OpenFile("/log/app.log", os.O_WRONLY|os.O_APPEND, 0)
+		defer w.Close()
+
+		if err := fs.Rename("/log/app.log", "/log/app.log.1"); err != nil {
+			t.Fatalf("Unexpected error from Rename: %v", err)
+		}
+		WriteFile(fs, "/log/app.log", []byte("new\n"), os.FileMode(0644))
+		w.Write([]byte("late\n"))
+
+		data, _ := ReadFile(fs, "/log/app.log.1")
+		if string(data) != "old\nlate\n" {
+			t.Fatalf("Unexpected rotated contents: '%v'", string(data))
+		}
+		data, _ = ReadFile(fs, "/log/app.log")
+		if string(data) != "new\n" {
+			t.Fatalf("Unexpected new contents: '%v'", string(data))
+		}
+	})
+
+	t.Run("RenameOver", func(t *testing.T) {
+		r, _ := fs.Open("/log/app.log.1")
+		defer r.Close()
+
+		if err := fs.Rename("/log/app.log", "/log/app.log.1"); err != nil {
+			t.Fatalf("Unexpected error from Rename: %v", err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil || string(data) != "old\nlate\n" {
+			t.Fatalf("Unexpected read result: '%v', %v", string(data), err)
+		}
+		info, _ := r.Stat()
+		if nlink := info.(*mockFileInfo).nlink; nlink != 0 {
+			t.Fatalf("Unexpected nlink: %v", nlink)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		f, _ := fs.OpenFile("/log/app.log.1", os.O_RDWR, 0)
+		defer f.Close()
+
+		if err := fs.Remove("/log/app.log.1"); err != nil {
+			t.Fatalf("Unexpected error from Remove: %v", err)
+		}
+		if _, err := fs.Stat("/log/app.log.1"); !os.IsNotExist(err) {
+			t.Fatalf("Expected not exist, got '%v'", err)
+		}
+		f.Seek(0, io.SeekEnd)
+		f.Write([]byte("gone\n"))
+		f.Seek(0, io.SeekStart)
+		data, err := io.ReadAll(f)
+		if err != nil || string(data) != "new\ngone\n" {
+			t.Fatalf("Unexpected read result: '%v', %v", string(data), err)
+		}
+	})
+
+	t.Run("RenameErrors", func(t *testing.T) {
+		fs.MkdirAll("/a/b", os.FileMode(0755))
+		fs.MkdirAll("/full/x", os.FileMode(0755))
+		WriteFile(fs, "/file", nil, os.FileMode(0644))
+
+		if err := fs.Rename("/a", "/a/b/c"); !errors.Is(err, syscall.EINVAL) {
+			t.Fatalf("Expected EINVAL, got '%v'", err)
+		}
+		if err := fs.Rename("/a", "/file"); !errors.Is(err, syscall.ENOTDIR) {
+			t.Fatalf("Expected ENOTDIR, got '%v'", err)
+		}
+		// Like os.Rename, an existing directory is never replaced.
+		if err := fs.Rename("/file", "/a"); !errors.Is(err, syscall.EEXIST) {
+			t.Fatalf("Expected EEXIST, got '%v'", err)
+		}
+		if err := fs.Rename("/a", "/full/x"); !errors.Is(err, syscall.EEXIST) {
+			t.Fatalf("Expected EEXIST, got '%v'", err)
+		}
+		if err := fs.Rename("/a", "/full/y"); err != nil {
+			t.Fatalf("Unexpected error from Rename: %v", err)
+		}
+		if exists, _ := DirExists(fs, "/full/y/b"); !exists {
+			t.Fatalf("Expected /full/y/b to exist")
+		}
+	})
+}
+
+func testReadFile(t *testing.T, fs FileSystem, path string, expected string) {
+	t.Run(fmt.Sprintf("ReadFile('%v')", path), func(t *testing.T) {
+		data, err := ReadFile(fs, path)
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadFile: %v", err)
+		}
+		if string(data) != expected {
+			t.Fatalf("Unexpected read result: '%v'", string(data))
+		}
+	})
+}
+
+func TestSymlinks(t *testing.T) {
+	fs := MockFs()
+	fs.MkdirAll("/a/b/c", os.FileMode(0755))
+	WriteFile(fs, "/a/b/c/file", []byte("c"), os.FileMode(0644))
+	WriteFile(fs, "/a/b/file", []byte("b"), os.FileMode(0644))
+	WriteFile(fs, "/a/file", []byte("a"), os.FileMode(0644))
+	fs.Mkdir("/links", os.FileMode(0755))
+
+	fs.Symlink("../a/b/c", "/links/rel")
+	fs.Symlink("/a/b/c", "/links/abs")
+	fs.Symlink("rel", "/links/chain")
+	fs.Symlink("loop2", "/links/loop1")
+	fs.Symlink("loop1", "/links/loop2")
+	fs.Symlink("bogus", "/links/dangling")
+
+	t.Run("Readlink", func(t *testing.T) {
+		target, err := fs.Readlink("/links/rel")
+		if err != nil {
+			t.Fatalf("Unexpected error from Readlink: %v", err)
+		}
+		if target != "../a/b/c" {
+			t.Fatalf("Unexpected target: '%v'", target)
+		}
+	})
+
+	testReadFile(t, fs, "/links/rel/file", "c")
+	testReadFile(t, fs, "/links/abs/file", "c")
+	testReadFile(t, fs, "/links/chain/file", "c")
+
+	// ".." after a symlink goes to the parent of the link's target, not back
+	// to the directory holding the link.
+	testReadFile(t, fs, "/links/rel/../file", "b")
+	testReadFile(t, fs, "/links/chain/../../file", "a")
+
+	t.Run("Relative", func(t *testing.T) {
+		fs.Chdir("/links")
+		defer fs.Chdir("/")
+		data, err := ReadFile(fs, "rel/file")
+		if err != nil || string(data) != "c" {
+			t.Fatalf("Unexpected read result: '%v', %v", string(data), err)
+		}
+	})
+
+	t.Run("Loop", func(t *testing.T) {
+		_, err := fs.Stat("/links/loop1")
+		if !errors.Is(err, syscall.ELOOP) {
+			t.Fatalf("Expected ELOOP, got '%v'", err)
+		}
+		if _, err := fs.Lstat("/links/loop1"); err != nil {
+			t.Fatalf("Unexpected error from Lstat: %v", err)
+		}
+	})
+
+	t.Run("Dangling", func(t *testing.T) {
+		if _, err := fs.Stat("/links/dangling"); !os.IsNotExist(err) {
+			t.Fatalf("Expected not exist, got '%v'", err)
+		}
+		if _, err := fs.Lstat("/links/dangling"); err != nil {
+			t.Fatalf("Unexpected error from Lstat: %v", err)
+		}
+	})
+
+	t.Run("Getwd", func(t *testing.T) {
+		fs.Chdir("/links/abs")
+		defer fs.Chdir("/")
+		wd, _ := fs.Getwd()
+		if wd != "/a/b/c" {
+			t.Fatalf("Unexpected working directory: '%v'", wd)
+		}
+		fs.Rename("/a/b", "/a/d")
+		wd, _ = fs.Getwd()
+		if wd != "/a/d/c" {
+			t.Fatalf("Unexpected working directory after rename: '%v'", wd)
+		}
+	})
+}
+
+// chunkReader returns chunks of data until it has returned n of them, calling
+// before first each time.
+type chunkReader struct {
+	n      int
+	before func()
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	r.before()
+	r.n--
+	return copy(b, strings.Repeat("x", mockCopyChunk)), nil
+}
+
+func TestReadFrom(t *testing.T) {
+	fs := MockFs()
+	f, err := fs.Create("/file")
+	if err != nil {
+		t.Fatalf("Unexpected error from Create: %v", err)
+	}
+	defer f.Close()
+
+	// Each chunk is written before the next is read.
+	var expected int64
+	r := &chunkReader{n: 4, before: func() {
+		info, err := fs.Stat("/file")
+		if err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		if info.Size() != expected {
+			t.Fatalf("Expected %v bytes written, got %v", expected, info.Size())
+		}
+		expected += mockCopyChunk
+	}}
+	n, err := io.Copy(f, r)
+	if n != 4*mockCopyChunk || err != nil {
+		t.Fatalf("Unexpected copy result: %v, %v", n, err)
+	}
+}
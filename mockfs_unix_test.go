@@ -0,0 +1,218 @@
+//go:build unix
+
+package gofs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func testOpenError(t *testing.T, fs FileSystem, path string, flag int, expected error) {
+	t.Run(path, func(t *testing.T) {
+		f, err := fs.OpenFile(path, flag, os.FileMode(0644))
+		if err == nil {
+			f.Close()
+		}
+		if !errors.Is(err, expected) {
+			t.Fatalf("Expected '%v', got '%v'", expected, err)
+		}
+	})
+}
+
+func TestOpenSymlinks(t *testing.T) {
+	fs := MockFs()
+	fs.MkdirAll("/dir", os.FileMode(0755))
+	WriteFile(fs, "/dir/file", []byte("file"), os.FileMode(0644))
+	fs.Symlink("file", "/dir/link")
+	fs.Symlink("target", "/dir/dangling")
+	fs.Symlink("/bogus/target", "/dir/nowhere")
+
+	t.Run("CreateThroughDangling", func(t *testing.T) {
+		f, err := fs.OpenFile("/dir/dangling", os.O_WRONLY|os.O_CREATE, os.FileMode(0644))
+		if err != nil {
+			t.Fatalf("Unexpected error from OpenFile: %v", err)
+		}
+		f.Write([]byte("created"))
+		f.Close()
+
+		testReadFile(t, fs, "/dir/target", "created")
+		target, _ := fs.Readlink("/dir/dangling")
+		if target != "target" {
+			t.Fatalf("Link was replaced: '%v'", target)
+		}
+	})
+
+	t.Run("Exclusive", func(t *testing.T) {
+		testOpenError(t, fs, "/dir/link", os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.ErrExist)
+		testOpenError(t, fs, "/dir/nowhere", os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.ErrExist)
+	})
+
+	t.Run("NoFollow", func(t *testing.T) {
+		testOpenError(t, fs, "/dir/link", os.O_RDONLY|syscall.O_NOFOLLOW, syscall.ELOOP)
+		testOpenError(t, fs, "/dir/dangling", os.O_WRONLY|os.O_CREATE|syscall.O_NOFOLLOW, syscall.ELOOP)
+
+		f, err := fs.OpenFile("/dir/file", os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error from OpenFile: %v", err)
+		}
+		f.Close()
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		testOpenError(t, fs, "/dir/file", os.O_RDONLY|syscall.O_DIRECTORY, syscall.ENOTDIR)
+		testOpenError(t, fs, "/dir/link", os.O_RDONLY|syscall.O_DIRECTORY, syscall.ENOTDIR)
+
+		f, err := fs.OpenFile("/dir", os.O_RDONLY|syscall.O_DIRECTORY, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error from OpenFile: %v", err)
+		}
+		f.Close()
+	})
+
+	testOpenError(t, fs, "/dir/nowhere", os.O_WRONLY|os.O_CREATE, syscall.ENOENT)
+}
+
+// errorParts breaks an error from the os package down into its Op and errno.
+func errorParts(err error) (string, error) {
+	switch e := err.(type) {
+	case *os.PathError:
+		return "PathError " + e.Op, e.Err
+	case *os.LinkError:
+		return "LinkError " + e.Op, e.Err
+	case *os.SyscallError:
+		return "SyscallError " + e.Syscall, e.Err
+	}
+	return "", err
+}
+
+func TestErrors(t *testing.T) {
+	setup := func(fs FileSystem, root string) {
+		fs.MkdirAll(root+"/dir/sub", os.FileMode(0755))
+		fs.Mkdir(root+"/empty", os.FileMode(0755))
+		WriteFile(fs, root+"/file", []byte("file"), os.FileMode(0644))
+	}
+
+	long := strings.Repeat("x", 300)
+
+	cases := []struct {
+		name string
+		op   func(fs FileSystem, root string) error
+	}{
+		{"OpenMissing", func(fs FileSystem, root string) error {
+			_, err := fs.Open(root + "/missing")
+			return err
+		}},
+		{"OpenThroughFile", func(fs FileSystem, root string) error {
+			_, err := fs.Open(root + "/file/x")
+			return err
+		}},
+		{"OpenDirForWrite", func(fs FileSystem, root string) error {
+			_, err := fs.OpenFile(root+"/dir", os.O_WRONLY, 0)
+			return err
+		}},
+		{"OpenExclusive", func(fs FileSystem, root string) error {
+			_, err := fs.OpenFile(root+"/file", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			return err
+		}},
+		{"OpenTooLong", func(fs FileSystem, root string) error {
+			_, err := fs.Open(root + "/" + long)
+			return err
+		}},
+		{"Chdir", func(fs FileSystem, root string) error {
+			return fs.Chdir(root + "/file")
+		}},
+		{"Mkdir", func(fs FileSystem, root string) error {
+			return fs.Mkdir(root+"/dir", os.FileMode(0755))
+		}},
+		{"MkdirAll", func(fs FileSystem, root string) error {
+			return fs.MkdirAll(root+"/file", os.FileMode(0755))
+		}},
+		{"Readlink", func(fs FileSystem, root string) error {
+			_, err := fs.Readlink(root + "/file")
+			return err
+		}},
+		{"RemoveNotEmpty", func(fs FileSystem, root string) error {
+			return fs.Remove(root + "/dir")
+		}},
+		{"Truncate", func(fs FileSystem, root string) error {
+			return fs.Truncate(root+"/dir", 0)
+		}},
+		{"Symlink", func(fs FileSystem, root string) error {
+			return fs.Symlink("target", root+"/file")
+		}},
+		{"Link", func(fs FileSystem, root string) error {
+			return fs.Link(root+"/dir", root+"/link")
+		}},
+		{"RenameMissing", func(fs FileSystem, root string) error {
+			return fs.Rename(root+"/missing", root+"/other")
+		}},
+		{"RenameOverDir", func(fs FileSystem, root string) error {
+			return fs.Rename(root+"/file", root+"/empty")
+		}},
+		{"RenameDirOverFile", func(fs FileSystem, root string) error {
+			return fs.Rename(root+"/dir", root+"/file")
+		}},
+		{"RenameIntoSelf", func(fs FileSystem, root string) error {
+			return fs.Rename(root+"/dir", root+"/dir/sub/x")
+		}},
+		{"ReaddirFile", func(fs FileSystem, root string) error {
+			f, err := fs.Open(root + "/file")
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Readdir(-1)
+			return err
+		}},
+		{"ReadDir", func(fs FileSystem, root string) error {
+			f, err := fs.Open(root + "/dir")
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Read(make([]byte, 1))
+			return err
+		}},
+		{"ReadClosed", func(fs FileSystem, root string) error {
+			f, err := fs.Open(root + "/file")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			_, err = f.Read(make([]byte, 1))
+			return err
+		}},
+		{"CloseTwice", func(fs FileSystem, root string) error {
+			f, err := fs.Open(root + "/file")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			return f.Close()
+		}},
+	}
+
+	mock := MockFs()
+	setup(mock, "")
+	osRoot := t.TempDir()
+	setup(OsFs(), osRoot)
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected := c.op(OsFs(), osRoot)
+			if expected == nil {
+				t.Fatalf("Expected an error from OsFs")
+			}
+			err := c.op(mock, "")
+
+			expectedOp, expectedErr := errorParts(expected)
+			op, errno := errorParts(err)
+			if op != expectedOp || !errors.Is(errno, expectedErr) {
+				t.Fatalf("Expected '%v', got '%v'", expected, err)
+			}
+		})
+	}
+}
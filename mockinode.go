@@ -0,0 +1,245 @@
+package gofs
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// mockInode is a file, directory or symlink in a MockFs. Directories map names
+// to inodes, so a file with several hard links has several names but only one
+// inode.
+//
+// Everything but the contents and timestamps is guarded by the file system's
+// lock; those are guarded by the inode's own, so that files can be read and
+// written with the file system only locked for reading.
+//
+// An inode belongs to the generation of the file system it was created or
+// copied in, and once a snapshot moves the file system on to a new generation,
+// it's frozen: it's shared with the snapshot, and never changes again.
+type mockInode struct {
+	ino   uint64
+	gen   uint64
+	mode  os.FileMode
+	uid   int
+	gid   int
+	nlink uint64
+
+	// The number of open handles to the inode.
+	open int
+
+	// For directories, the directory containing this one.
+	parent   *mockInode
+	children map[string]*mockInode
+
+	mu sync.Mutex
+
+	// The contents of a regular file, or the target of a symlink. The target
+	// of a symlink never changes, so it's safe to read without mu.
+	data []byte
+
+	// Whether data is shared with a frozen inode, and so has to be copied
+	// before it's written.
+	shared bool
+
+	// The parts of a regular file that have been written, as opposed to
+	// holes left by seeking or truncating past the end.
+	written extents
+
+	atime time.Time
+	mtime time.Time
+	ctime time.Time
+}
+
+func (n *mockInode) isDir() bool {
+	return n.mode.IsDir()
+}
+
+func (n *mockInode) isSymlink() bool {
+	return n.mode&os.ModeSymlink != 0
+}
+
+// clone copies the inode into generation gen. The copy shares the contents
+// until it's written.
+func (n *mockInode) clone(gen uint64) *mockInode {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	c := &mockInode{
+		ino:     n.ino,
+		gen:     gen,
+		mode:    n.mode,
+		uid:     n.uid,
+		gid:     n.gid,
+		nlink:   n.nlink,
+		open:    n.open,
+		parent:  n.parent,
+		data:    n.data,
+		shared:  n.data != nil,
+		written: n.written,
+		atime:   n.atime,
+		mtime:   n.mtime,
+		ctime:   n.ctime,
+	}
+	if n.children != nil {
+		c.children = maps.Clone(n.children)
+	}
+	return c
+}
+
+// unshare gives the inode its own copy of its contents, if they're shared.
+func (n *mockInode) unshare() {
+	if n.shared {
+		n.data = slices.Clone(n.data)
+		n.shared = false
+	}
+}
+
+// modified records a change to the contents of the inode.
+func (n *mockInode) modified(now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.mtime = now
+	n.ctime = now
+}
+
+// changed records a change to the metadata of the inode.
+func (n *mockInode) changed(now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.ctime = now
+}
+
+// setTimes changes the access and modification times, leaving zero times
+// unchanged.
+func (n *mockInode) setTimes(atime time.Time, mtime time.Time, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !atime.IsZero() {
+		n.atime = atime
+	}
+	if !mtime.IsZero() {
+		n.mtime = mtime
+	}
+	n.ctime = now
+}
+
+// size returns the size of a regular file.
+func (n *mockInode) size() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return int64(len(n.data))
+}
+
+// read copies the contents of a regular file from off into b, returning the
+// number of bytes copied.
+func (n *mockInode) read(b []byte, off int64, now time.Time) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if off >= int64(len(n.data)) {
+		return 0
+	}
+	n.atime = now
+	return copy(b, n.data[off:])
+}
+
+// write copies b into a regular file at off, or at the end if appending,
+// filling any gap past the old end with zeros. It returns the offset just past
+// the bytes written.
+func (n *mockInode) write(b []byte, off int64, appending bool, now time.Time) int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if appending {
+		off = int64(len(n.data))
+	}
+	if len(b) == 0 {
+		return off
+	}
+	n.unshare()
+
+	end := off + int64(len(b))
+	if end > int64(len(n.data)) {
+		if end > int64(cap(n.data)) {
+			// Grow geometrically, so that lots of small appends are cheap.
+			buf := make([]byte, len(n.data), end+int64(len(n.data)))
+			copy(buf, n.data)
+			n.data = buf
+		}
+		// Anything between the old end and off reads back as zeros, even if
+		// the buffer held something there before a truncate.
+		old := len(n.data)
+		n.data = n.data[:end]
+		clear(n.data[old:end])
+	}
+	copy(n.data[off:], b)
+	n.written = n.written.add(off, end)
+	n.mtime = now
+	n.ctime = now
+	return end
+}
+
+// seekData returns the offset of the next data, or the next hole if hole is
+// set, at or after off. It fails if off is past the end of the file, or if
+// there's no more data.
+func (n *mockInode) seekData(off int64, hole bool) (int64, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	size := int64(len(n.data))
+	if off < 0 || off >= size {
+		return 0, false
+	}
+	if hole {
+		// The end of the file counts as a hole.
+		return min(n.written.hole(off), size), true
+	}
+	return n.written.data(off)
+}
+
+// truncate changes the size of a regular file, padding it with zeros if it
+// grows.
+func (n *mockInode) truncate(size int64, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.unshare()
+	if size < int64(len(n.data)) {
+		n.data = n.data[0:size]
+		n.written = n.written.truncate(size)
+	} else {
+		buf := make([]byte, size)
+		copy(buf, n.data)
+		n.data = buf
+	}
+	n.mtime = now
+	n.ctime = now
+}
+
+// release frees the inode's contents once nothing refers to it any more.
+func (n *mockInode) release() {
+	if n.nlink == 0 && n.open == 0 {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.data = nil
+		n.written = nil
+		n.children = nil
+	}
+}
+
+// info describes the inode as it is right now.
+func (n *mockInode) info(name string) *mockFileInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &mockFileInfo{
+		name:   name,
+		size:   int64(len(n.data)),
+		mode:   n.mode,
+		ino:    n.ino,
+		uid:    n.uid,
+		gid:    n.gid,
+		nlink:  n.nlink,
+		atime:  n.atime,
+		mtime:  n.mtime,
+		ctime:  n.ctime,
+		blocks: n.written.blocks(),
+	}
+}
@@ -0,0 +1,160 @@
+package gofs
+
+import (
+	"strings"
+	"syscall"
+)
+
+// maxSymlinks is the number of symlinks Linux follows while resolving a path
+// before giving up with ELOOP.
+const maxSymlinks = 40
+
+// The limits Linux places on a single path component, and on a whole path
+// including its terminating NUL.
+const (
+	maxName = 255
+	maxPath = 4096
+)
+
+// walk resolves path, relative to the current directory if it isn't absolute,
+// the way the kernel does: symlinks in intermediate components are always
+// followed, and ".." refers to the parent of the directory actually reached,
+// not to whatever the path looks like lexically. The last component is only
+// followed if follow is set, or if the path has a trailing slash.
+//
+// walk returns the directory holding the last component, the name of that
+// component, and the inode it refers to, which is nil if it doesn't exist. The
+// name is "." or ".." when the path ends in one of those.
+func (fs *mockFileSystem) walk(path string, follow bool) (*mockInode, string, *mockInode, error) {
+	if path == "" {
+		return nil, "", nil, syscall.ENOENT
+	}
+	if len(path) >= maxPath {
+		return nil, "", nil, syscall.ENAMETOOLONG
+	}
+
+	start := fs.current(fs.cwd)
+	if strings.HasPrefix(path, "/") {
+		start = fs.current(fs.root)
+	}
+	mustDir := strings.HasSuffix(path, "/")
+
+	hops := 0
+	dir, name, info, err := fs.resolve(start, path, follow || mustDir, &hops)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if mustDir && info != nil && !info.isDir() {
+		return nil, "", nil, syscall.ENOTDIR
+	}
+	return dir, name, info, nil
+}
+
+// resolve is walk, starting from dir and counting symlinks in hops.
+func (fs *mockFileSystem) resolve(dir *mockInode, path string, follow bool, hops *int) (*mockInode, string, *mockInode, error) {
+	components := splitPath(path)
+	if len(components) == 0 {
+		// The path was "/".
+		return dir, ".", dir, nil
+	}
+
+	for {
+		name := components[0]
+		components = components[1:]
+		last := len(components) == 0
+
+		if len(name) > maxName {
+			return nil, "", nil, syscall.ENAMETOOLONG
+		}
+		if !dir.isDir() {
+			return nil, "", nil, syscall.ENOTDIR
+		}
+		if !fs.canAccess(dir, accessExec) {
+			return nil, "", nil, syscall.EACCES
+		}
+
+		var info *mockInode
+		switch name {
+		case ".":
+			info = dir
+		case "..":
+			info = fs.current(dir.parent)
+		default:
+			if child := dir.children[name]; child != nil {
+				info = fs.current(child)
+			}
+		}
+
+		if info != nil && info.isSymlink() && (!last || follow) {
+			*hops++
+			if *hops > maxSymlinks {
+				return nil, "", nil, syscall.ELOOP
+			}
+			target := string(info.data)
+			if strings.HasPrefix(target, "/") {
+				dir = fs.current(fs.root)
+			}
+			// Relative targets are resolved against the directory holding
+			// the link, which is where we already are.
+			expanded := splitPath(target)
+			if len(expanded) == 0 {
+				if target == "" {
+					return nil, "", nil, syscall.ENOENT
+				}
+				if last {
+					return dir, ".", dir, nil
+				}
+			}
+			components = append(expanded, components...)
+			continue
+		}
+
+		if last {
+			return dir, name, info, nil
+		}
+		if info == nil {
+			return nil, "", nil, syscall.ENOENT
+		}
+		dir = info
+	}
+}
+
+// splitPath breaks a path into its non-empty components.
+func splitPath(path string) []string {
+	var ret []string
+	for _, c := range strings.Split(path, "/") {
+		if c != "" {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// dirPath returns the absolute path of a directory, or ENOENT if it has been
+// removed.
+func (fs *mockFileSystem) dirPath(info *mockInode) (string, error) {
+	var names []string
+	for info.ino != fs.root.ino {
+		if info.nlink == 0 {
+			return "", syscall.ENOENT
+		}
+		parent := fs.current(info.parent)
+		for name, child := range parent.children {
+			if child.ino == info.ino {
+				names = append(names, name)
+				break
+			}
+		}
+		info = parent
+	}
+
+	var b strings.Builder
+	for i := len(names) - 1; i >= 0; i-- {
+		b.WriteString("/")
+		b.WriteString(names[i])
+	}
+	if b.Len() == 0 {
+		return "/", nil
+	}
+	return b.String(), nil
+}
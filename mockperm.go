@@ -0,0 +1,165 @@
+package gofs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Access bits, as passed to access(2).
+const (
+	accessRead  = 4
+	accessWrite = 2
+	accessExec  = 1
+)
+
+// The mode bits that chmod is allowed to change.
+const chmodMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// IdentityFs is a file system whose notion of the current user can be changed.
+type IdentityFs interface {
+	// SetIdentity makes the file system act as the given user, with primary
+	// group gid and supplementary groups, and turns on permission checks.
+	SetIdentity(uid, gid int, groups ...int)
+}
+
+// WithIdentity makes MockFs act as the given user, with primary group gid and
+// supplementary groups, and enforce permission bits the way Linux does. The
+// root directory and any new files are owned by uid and gid.
+func WithIdentity(uid, gid int, groups ...int) MockOption {
+	return func(fs *mockFileSystem) {
+		fs.SetIdentity(uid, gid, groups...)
+	}
+}
+
+func (fs *mockFileSystem) SetIdentity(uid, gid int, groups ...int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.uid = uid
+	fs.gid = gid
+	fs.groups = append([]int(nil), groups...)
+	fs.enforce = true
+}
+
+func (fs *mockFileSystem) inGroup(gid int) bool {
+	if gid == fs.gid {
+		return true
+	}
+	for _, g := range fs.groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccess checks whether the current user has all the access bits in want
+// on info.
+func (fs *mockFileSystem) canAccess(info *mockInode, want os.FileMode) bool {
+	if !fs.enforce || fs.uid == 0 {
+		return true
+	}
+
+	perm := info.mode & os.ModePerm
+	switch {
+	case info.uid == fs.uid:
+		perm >>= 6
+	case fs.inGroup(info.gid):
+		perm >>= 3
+	}
+	return perm&want == want
+}
+
+func (fs *mockFileSystem) checkAccess(op string, path string, info *mockInode, want os.FileMode) error {
+	if fs.canAccess(info, want) {
+		return nil
+	}
+	return &os.PathError{
+		Op:   op,
+		Err:  syscall.EACCES,
+		Path: path,
+	}
+}
+
+// isOwner checks whether the current user may change the metadata of info.
+func (fs *mockFileSystem) isOwner(info *mockInode) bool {
+	return !fs.enforce || fs.uid == 0 || info.uid == fs.uid
+}
+
+func (fs *mockFileSystem) checkOwner(op string, path string, info *mockInode) error {
+	if fs.isOwner(info) {
+		return nil
+	}
+	return &os.PathError{
+		Op:   op,
+		Err:  syscall.EPERM,
+		Path: path,
+	}
+}
+
+// checkUnlink checks whether the current user may remove or replace the entry
+// info in dirInfo, which also requires honouring the sticky bit.
+func (fs *mockFileSystem) checkUnlink(op string, path string, dirInfo *mockInode, info *mockInode) error {
+	if err := fs.checkAccess(op, path, dirInfo, accessWrite|accessExec); err != nil {
+		return err
+	}
+	if dirInfo.mode&os.ModeSticky != 0 && !fs.isOwner(info) && !fs.isOwner(dirInfo) {
+		return &os.PathError{
+			Op:   op,
+			Err:  syscall.EPERM,
+			Path: path,
+		}
+	}
+	return nil
+}
+
+// owner returns the owner and group of a new entry in dirInfo, and the mode
+// bits it inherits from it.
+func (fs *mockFileSystem) owner(dirInfo *mockInode) (int, int, os.FileMode) {
+	if dirInfo.mode&os.ModeSetgid != 0 {
+		return fs.uid, dirInfo.gid, os.ModeSetgid
+	}
+	return fs.uid, fs.gid, 0
+}
+
+// chmod changes the permission bits of info, which only its owner may do.
+func (fs *mockFileSystem) chmod(op string, path string, info *mockInode, mode os.FileMode) error {
+	if err := fs.checkOwner(op, path, info); err != nil {
+		return err
+	}
+	info = fs.own(info)
+	info.mode = (info.mode & os.ModeType) | (mode & chmodMask)
+	info.changed(fs.now())
+	return nil
+}
+
+// chown changes the owner and group of info, following the Linux rules: only
+// root may give a file away, and an owner may only change its group to one they
+// belong to. A uid or gid of -1 is left unchanged.
+func (fs *mockFileSystem) chown(op string, path string, info *mockInode, uid, gid int) error {
+	if uid == -1 {
+		uid = info.uid
+	}
+	if gid == -1 {
+		gid = info.gid
+	}
+	if fs.enforce && fs.uid != 0 {
+		if info.uid != fs.uid || uid != info.uid || (gid != info.gid && !fs.inGroup(gid)) {
+			return &os.PathError{
+				Op:   op,
+				Err:  syscall.EPERM,
+				Path: path,
+			}
+		}
+	}
+
+	info = fs.own(info)
+	info.uid = uid
+	info.gid = gid
+	if info.mode.IsRegular() {
+		// Changing ownership drops set-user-ID and set-group-ID.
+		info.mode &^= os.ModeSetuid | os.ModeSetgid
+	}
+	info.changed(fs.now())
+	return nil
+}
@@ -0,0 +1,8 @@
+package gofs
+
+// Seek whence values for finding data and holes in sparse files, which the os
+// package doesn't define.
+const (
+	seekHole = 3
+	seekData = 4
+)
@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package gofs
+
+// Seek whence values for finding data and holes in sparse files, which the os
+// package doesn't define.
+const (
+	seekData = 3
+	seekHole = 4
+)
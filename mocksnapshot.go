@@ -0,0 +1,185 @@
+package gofs
+
+import (
+	"maps"
+	"sync/atomic"
+)
+
+// SnapshotFs is a file system whose whole state can be saved and restored
+// cheaply.
+type SnapshotFs interface {
+	// Snapshot returns the current state of the file system. The snapshot
+	// never changes, whatever happens to the file system afterwards, and can
+	// be restored into any number of file systems.
+	Snapshot() *Snapshot
+
+	// Restore puts the file system back into the state s was taken in,
+	// including the current directory. Any Files open on the file system are
+	// closed.
+	Restore(s *Snapshot)
+
+	// Clone returns a new file system, in the same state as this one and
+	// with the same options, that changes independently of it.
+	Clone() FileSystem
+}
+
+// Snapshot is the state of a MockFs at some point in time.
+//
+// Taking a snapshot doesn't copy anything: the file system and the snapshot
+// share every inode, and the file system only copies one when it's about to
+// change it. Restoring a snapshot doesn't copy anything either, so a test can
+// build a tree once and give each of its subtests a fresh copy for nothing.
+type Snapshot struct {
+	root *mockInode
+	cwd  *mockInode
+	ino  uint64
+
+	// The latest version of each inode that has been copied.
+	versions *mockVersions
+}
+
+// mockGen hands out the generations of MockFs state, which are unique across
+// all file systems so that no two ever own the same inode.
+var mockGen atomic.Uint64
+
+// mockMaxDepth is how many layers of versions a lookup goes through before the
+// next snapshot merges them into one.
+const mockMaxDepth = 8
+
+// mockVersions is a layer of the latest versions of copied inodes, over the
+// layers of the snapshots before it. Only a file system's top layer changes;
+// taking a snapshot freezes it and starts a new one on top, so nothing is
+// copied.
+type mockVersions struct {
+	inodes map[uint64]*mockInode
+	parent *mockVersions
+	depth  int
+}
+
+func newMockVersions(parent *mockVersions) *mockVersions {
+	v := &mockVersions{
+		inodes: make(map[uint64]*mockInode),
+		parent: parent,
+	}
+	if parent != nil {
+		v.depth = parent.depth + 1
+	}
+	return v
+}
+
+// get returns the latest version of inode ino, or nil if it's never been
+// copied.
+func (v *mockVersions) get(ino uint64) *mockInode {
+	for ; v != nil; v = v.parent {
+		if n := v.inodes[ino]; n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// flatten returns a single layer with the same versions as v and the layers
+// beneath it.
+func (v *mockVersions) flatten() *mockVersions {
+	var layers []*mockVersions
+	for ; v != nil; v = v.parent {
+		layers = append(layers, v)
+	}
+	flat := newMockVersions(nil)
+	for i := len(layers) - 1; i >= 0; i-- {
+		maps.Copy(flat.inodes, layers[i].inodes)
+	}
+	return flat
+}
+
+// current returns the latest version of n.
+func (fs *mockFileSystem) current(n *mockInode) *mockInode {
+	fs.vmu.Lock()
+	defer fs.vmu.Unlock()
+	return fs.latest(n)
+}
+
+func (fs *mockFileSystem) latest(n *mockInode) *mockInode {
+	if v := fs.versions.get(n.ino); v != nil {
+		return v
+	}
+	return n
+}
+
+// own returns the latest version of n, copying it first if it's frozen, so that
+// it can be changed. Since inodes are copied by number, the copy is seen
+// through every hard link, open File and ".." that leads to it.
+func (fs *mockFileSystem) own(n *mockInode) *mockInode {
+	fs.vmu.Lock()
+	defer fs.vmu.Unlock()
+	n = fs.latest(n)
+	if n.gen == fs.gen {
+		return n
+	}
+	c := n.clone(fs.gen)
+	if n.gen < fs.restored {
+		// The Files that had it open were closed by the restore.
+		c.open = 0
+	}
+	fs.versions.inodes[n.ino] = c
+	return c
+}
+
+// snapshot freezes every inode the file system has, and returns them.
+func (fs *mockFileSystem) snapshot() *Snapshot {
+	frozen := fs.versions
+	switch {
+	case len(frozen.inodes) == 0:
+		frozen = frozen.parent
+	case frozen.depth >= mockMaxDepth:
+		frozen = frozen.flatten()
+	}
+	fs.versions = newMockVersions(frozen)
+	fs.gen = mockGen.Add(1)
+	return &Snapshot{
+		root:     fs.root,
+		cwd:      fs.cwd,
+		ino:      fs.ino,
+		versions: frozen,
+	}
+}
+
+// restore makes s the file system's state.
+func (fs *mockFileSystem) restore(s *Snapshot) {
+	fs.root = s.root
+	fs.cwd = s.cwd
+	fs.ino = s.ino
+	fs.versions = newMockVersions(s.versions)
+	fs.gen = mockGen.Add(1)
+	fs.restored = fs.gen
+	fs.epoch++
+}
+
+func (fs *mockFileSystem) Snapshot() *Snapshot {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.snapshot()
+}
+
+func (fs *mockFileSystem) Restore(s *Snapshot) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.restore(s)
+}
+
+func (fs *mockFileSystem) Clone() FileSystem {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	clone := &mockFileSystem{
+		clock:   fs.clock,
+		shuffle: fs.shuffle,
+		seed:    fs.seed,
+		uid:     fs.uid,
+		gid:     fs.gid,
+		groups:  append([]int(nil), fs.groups...),
+		enforce: fs.enforce,
+	}
+	clone.restore(fs.snapshot())
+	return clone
+}
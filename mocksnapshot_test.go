@@ -0,0 +1,226 @@
+package gofs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// describe lists everything beneath dir, with enough detail to tell any two
+// different trees apart.
+func describe(t *testing.T, fs FileSystem, dir string) string {
+	t.Helper()
+	f, err := fs.Open(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error from Open: %v", err)
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error from Readdirnames: %v", err)
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		info, err := fs.Lstat(path)
+		if err != nil {
+			t.Fatalf("Unexpected error from Lstat: %v", err)
+		}
+		nlink := info.(*mockFileInfo).nlink
+		fmt.Fprintf(&b, "%v %v %v", path, info.Mode(), nlink)
+		switch {
+		case info.IsDir():
+			fmt.Fprintf(&b, "\n%v", describe(t, fs, path))
+		case info.Mode()&os.ModeSymlink != 0:
+			target, _ := fs.Readlink(path)
+			fmt.Fprintf(&b, " -> %v\n", target)
+		default:
+			data, _ := ReadFile(fs, path)
+			fmt.Fprintf(&b, " %q\n", data)
+		}
+	}
+	return b.String()
+}
+
+// fixture builds a small tree with a bit of everything in it.
+func fixture(t *testing.T) SnapshotFs {
+	fs := MockFs()
+	fs.MkdirAll("/home/user/docs", os.FileMode(0755))
+	fs.MkdirAll("/tmp", os.FileMode(0777))
+	WriteFile(fs, "/home/user/docs/readme", []byte("Hello World"), os.FileMode(0644))
+	WriteFile(fs, "/home/user/notes", []byte("one"), os.FileMode(0600))
+	if err := fs.Link("/home/user/notes", "/tmp/notes"); err != nil {
+		t.Fatalf("Unexpected error from Link: %v", err)
+	}
+	if err := fs.Symlink("docs/readme", "/home/user/readme"); err != nil {
+		t.Fatalf("Unexpected error from Symlink: %v", err)
+	}
+	if err := fs.Chdir("/home/user"); err != nil {
+		t.Fatalf("Unexpected error from Chdir: %v", err)
+	}
+	return fs.(SnapshotFs)
+}
+
+func TestSnapshot(t *testing.T) {
+	sfs := fixture(t)
+	fs := sfs.(FileSystem)
+	s := sfs.Snapshot()
+	expected := describe(t, fs, "/")
+
+	changes := map[string]func(t *testing.T){
+		"Write": func(t *testing.T) {
+			WriteFile(fs, "readme", []byte("Goodbye"), os.FileMode(0644))
+		},
+		"Append": func(t *testing.T) {
+			f, err := fs.OpenFile("/tmp/notes", os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatalf("Unexpected error from OpenFile: %v", err)
+			}
+			f.Write([]byte(" two"))
+			f.Close()
+			// Both links see the change.
+			testReadFile(t, fs, "/home/user/notes", "one two")
+		},
+		"Truncate": func(t *testing.T) {
+			fs.Truncate("docs/readme", 5)
+		},
+		"Remove": func(t *testing.T) {
+			if err := fs.RemoveAll("/home"); err != nil {
+				t.Fatalf("Unexpected error from RemoveAll: %v", err)
+			}
+			testNlink(t, fs, "/tmp/notes", 1)
+		},
+		"Rename": func(t *testing.T) {
+			if err := fs.Rename("/home/user/docs", "/tmp/docs"); err != nil {
+				t.Fatalf("Unexpected error from Rename: %v", err)
+			}
+			// ".." follows the directory to its new home.
+			testReadFile(t, fs, "/tmp/docs/../notes", "one")
+		},
+		"Metadata": func(t *testing.T) {
+			fs.Chmod("/home/user/notes", os.FileMode(0644))
+			fs.Chdir("/tmp")
+			fs.Mkdir("new", os.FileMode(0755))
+		},
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			change(t)
+			if describe(t, fs, "/") == expected {
+				t.Fatalf("Expected %v to change the tree", name)
+			}
+			sfs.Restore(s)
+			if actual := describe(t, fs, "/"); actual != expected {
+				t.Fatalf("Expected:\n%v\ngot:\n%v", expected, actual)
+			}
+			if wd, _ := fs.Getwd(); wd != "/home/user" {
+				t.Fatalf("Expected to be back in /home/user, got %v", wd)
+			}
+		})
+	}
+}
+
+func TestSnapshotOpenFile(t *testing.T) {
+	sfs := fixture(t)
+	fs := sfs.(FileSystem)
+	f, err := fs.OpenFile("/home/user/notes", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error from OpenFile: %v", err)
+	}
+
+	// Files opened before a snapshot keep working, without changing it.
+	s := sfs.Snapshot()
+	f.WriteAt([]byte("ONE"), 0)
+	testReadFile(t, fs, "/tmp/notes", "ONE")
+
+	clone := MockFs()
+	clone.(SnapshotFs).Restore(s)
+	testReadFile(t, clone, "/tmp/notes", "one")
+
+	// Restoring closes them.
+	sfs.Restore(s)
+	if _, err := f.Write([]byte("two")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got '%v'", err)
+	}
+	testReadFile(t, fs, "/tmp/notes", "one")
+
+	// So removing the file frees it, as nothing has it open any more.
+	info, err := fs.Stat("/tmp/notes")
+	if err != nil {
+		t.Fatalf("Unexpected error from Stat: %v", err)
+	}
+	fs.Remove("/tmp/notes")
+	fs.Remove("/home/user/notes")
+	mfs := fs.(*mockFileSystem)
+	if n := mfs.versions.get(info.(*mockFileInfo).ino); n == nil || n.data != nil {
+		t.Fatalf("Expected the removed file to be freed")
+	}
+}
+
+func TestSnapshotLayers(t *testing.T) {
+	sfs := fixture(t)
+	fs := sfs.(FileSystem)
+	var snapshots []*Snapshot
+	for i := range 3 * mockMaxDepth {
+		WriteFile(fs, "/tmp/notes", []byte(fmt.Sprint(i)), os.FileMode(0600))
+		snapshots = append(snapshots, sfs.Snapshot())
+		// Snapshots with nothing new in them don't add layers.
+		sfs.Snapshot()
+	}
+	if depth := fs.(*mockFileSystem).versions.depth; depth > mockMaxDepth {
+		t.Fatalf("Too many layers: %v", depth)
+	}
+	for i, s := range snapshots {
+		sfs.Restore(s)
+		testReadFile(t, fs, "/home/user/notes", fmt.Sprint(i))
+	}
+}
+
+func TestClone(t *testing.T) {
+	sfs := fixture(t)
+	fs := sfs.(FileSystem)
+	expected := describe(t, fs, "/")
+
+	clone := sfs.Clone()
+	WriteFile(clone, "/home/user/notes", []byte("clone"), os.FileMode(0600))
+	clone.Mkdir("/tmp/clone", os.FileMode(0755))
+	fs.Remove("/tmp/notes")
+
+	testReadFile(t, clone, "/tmp/notes", "clone")
+	testDirExists(t, fs, "/tmp/clone", false)
+	testFileExists(t, fs, "/tmp/notes", false)
+
+	// Snapshots can be moved between file systems either way.
+	sfs.Restore(clone.(SnapshotFs).Snapshot())
+	testDirExists(t, fs, "/tmp/clone", true)
+	testReadFile(t, fs, "/tmp/notes", "clone")
+	clone.Remove("/tmp/clone")
+	WriteFile(clone, "/home/user/notes", []byte("one"), os.FileMode(0600))
+	if actual := describe(t, clone, "/"); actual != expected {
+		t.Fatalf("Expected:\n%v\ngot:\n%v", expected, actual)
+	}
+
+	t.Run("Concurrent", func(t *testing.T) {
+		base := fixture(t)
+		var wg sync.WaitGroup
+		for i := range stressWorkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fs := base.Clone()
+				name := fmt.Sprintf("/tmp/file%v", i)
+				WriteFile(fs, name, []byte(name), os.FileMode(0644))
+				WriteFile(fs, "/home/user/notes", []byte(name), os.FileMode(0600))
+				testReadFile(t, fs, "/tmp/notes", name)
+			}()
+		}
+		wg.Wait()
+		testReadFile(t, base.(FileSystem), "/tmp/notes", "one")
+		testFileExists(t, base.(FileSystem), "/tmp/file0", false)
+	})
+}
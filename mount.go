@@ -0,0 +1,540 @@
+package gofs
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MountableFs is a file system that other file systems can be mounted on.
+type MountableFs interface {
+	FileSystem
+
+	// Mount makes the root of fs appear at prefix, hiding anything that was
+	// there. The directory above prefix must exist, but prefix itself needn't.
+	Mount(prefix string, fs FileSystem) error
+
+	// Unmount removes the file system mounted at prefix.
+	Unmount(prefix string) error
+}
+
+type mountFilesystem struct {
+	// mu guards mounts and cwd.
+	mu  sync.RWMutex
+	cwd string
+
+	// The mounted file systems, by the symlink-free path they're mounted at.
+	mounts map[string]FileSystem
+}
+
+// MountFs creates a MountableFs with root mounted at "/". Each method goes to
+// the file system with the longest mount point containing the path, which
+// sees the path relative to where it's mounted. Symlinks are resolved across
+// the combined namespace, and listing a directory shows the mount points in
+// it.
+//
+// Like Linux, MountFs refuses to Rename or Link from one file system to
+// another with syscall.EXDEV, and to remove or rename a mount point, or a
+// directory with one beneath it, with syscall.EBUSY.
+func MountFs(root FileSystem) MountableFs {
+	return &mountFilesystem{
+		cwd:    "/",
+		mounts: map[string]FileSystem{"/": root},
+	}
+}
+
+func (fs *mountFilesystem) abs(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(fs.cwd, path)
+}
+
+// route finds the file system holding path, which must not go through any
+// symlinks, and returns its mount point, the file system itself, and the path
+// within it. Mount points, unlike file systems, can always be compared.
+func (fs *mountFilesystem) route(path string) (string, FileSystem, string) {
+	for prefix := path; ; prefix = filepath.Dir(prefix) {
+		if mounted := fs.mounts[prefix]; mounted != nil {
+			return prefix, mounted, filepath.Join("/", strings.TrimPrefix(path, prefix))
+		}
+	}
+}
+
+// lstat is Lstat of a path that doesn't go through any symlinks.
+func (fs *mountFilesystem) lstat(path string) (os.FileInfo, error) {
+	_, mounted, inner := fs.route(path)
+	return mounted.Lstat(inner)
+}
+
+// readlink is Readlink of a path that doesn't go through any symlinks.
+func (fs *mountFilesystem) readlink(path string) (string, error) {
+	_, mounted, inner := fs.route(path)
+	return mounted.Readlink(inner)
+}
+
+// resolve turns name into an absolute path in the combined namespace with no
+// symlinks in it.
+func (fs *mountFilesystem) resolve(name string, follow bool) (string, error) {
+	r := resolver{
+		lstat:    fs.lstat,
+		readlink: fs.readlink,
+	}
+	return r.resolve(fs.cwd, name, follow)
+}
+
+// path resolves name, and routes it to the file system holding it. Any trailing
+// slash is kept, so that the file system still insists on a directory.
+func (fs *mountFilesystem) path(name string, follow bool) (string, FileSystem, string, error) {
+	path, err := fs.resolve(name, follow)
+	if err != nil {
+		return "", nil, "", err
+	}
+	point, mounted, inner := fs.route(path)
+	if strings.HasSuffix(name, "/") && !strings.HasSuffix(inner, "/") {
+		inner += "/"
+	}
+	return point, mounted, inner, nil
+}
+
+// under returns whether anything is mounted strictly beneath path.
+func (fs *mountFilesystem) under(path string) bool {
+	for prefix := range fs.mounts {
+		if prefix != path && (path == "/" || strings.HasPrefix(prefix, path+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// removable resolves name for removing or renaming it, which isn't allowed for
+// a mount point or a directory with one beneath it, or for a path ending in "."
+// or "..".
+func (fs *mountFilesystem) removable(name string) (string, FileSystem, string, error) {
+	path, err := fs.resolve(name, false)
+	if err != nil {
+		return "", nil, "", err
+	}
+	switch base := filepath.Base(name); {
+	case base == "." || base == "..":
+		return "", nil, "", syscall.EINVAL
+	case fs.mounts[path] != nil || fs.under(path):
+		return "", nil, "", syscall.EBUSY
+	}
+	point, mounted, inner := fs.route(path)
+	return point, mounted, inner, nil
+}
+
+func (fs *mountFilesystem) Mount(prefix string, mounted FileSystem) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.resolve(prefix, true)
+	if err != nil {
+		return opError("mount", prefix, err)
+	}
+	if fs.mounts[path] != nil {
+		return opError("mount", prefix, syscall.EBUSY)
+	}
+	info, err := fs.lstat(filepath.Dir(path))
+	if err == nil && !info.IsDir() {
+		err = syscall.ENOTDIR
+	}
+	if err == nil {
+		info, err = fs.lstat(path)
+		if err == nil && !info.IsDir() {
+			err = syscall.ENOTDIR
+		} else if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return opError("mount", prefix, err)
+	}
+
+	fs.mounts[path] = mounted
+	return nil
+}
+
+func (fs *mountFilesystem) Unmount(prefix string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.resolve(prefix, true)
+	if err != nil {
+		return opError("unmount", prefix, err)
+	}
+	if path == "/" || fs.mounts[path] == nil {
+		return opError("unmount", prefix, syscall.EINVAL)
+	}
+	delete(fs.mounts, path)
+	return nil
+}
+
+// stat is Stat and Lstat.
+func (fs *mountFilesystem) stat(op string, name string, follow bool) (os.FileInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, mounted, inner, err := fs.path(name, follow)
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+	// The path is free of symlinks, apart from perhaps the last component
+	// if it isn't to be followed.
+	info, err := mounted.Lstat(inner)
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+	if base := filepath.Base(name); info.Name() != base {
+		// The root of a mounted file system is named "/".
+		info = &renamedInfo{info, base}
+	}
+	return info, nil
+}
+
+func (fs *mountFilesystem) Stat(name string) (os.FileInfo, error) {
+	return fs.stat("stat", name, true)
+}
+
+func (fs *mountFilesystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.stat("lstat", name, false)
+}
+
+func (fs *mountFilesystem) Getwd() (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.cwd, nil
+}
+
+func (fs *mountFilesystem) Chdir(dir string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.resolve(dir, true)
+	if err != nil {
+		return opError("chdir", dir, err)
+	}
+	info, err := fs.lstat(path)
+	if err != nil {
+		return opError("chdir", dir, err)
+	}
+	if !info.IsDir() {
+		return &os.PathError{
+			Op:   "chdir",
+			Err:  syscall.ENOTDIR,
+			Path: dir,
+		}
+	}
+	fs.cwd = path
+	return nil
+}
+
+func (fs *mountFilesystem) Abs(path string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.abs(path), nil
+}
+
+// apply resolves name and calls f with the file system holding it and the
+// path within it.
+func (fs *mountFilesystem) apply(op string, name string, follow bool, f func(mounted FileSystem, path string) error) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, mounted, inner, err := fs.path(name, follow)
+	if err != nil {
+		return opError(op, name, err)
+	}
+	if err := f(mounted, inner); err != nil {
+		return pathErr(op, name, err)
+	}
+	return nil
+}
+
+func (fs *mountFilesystem) Chmod(name string, mode os.FileMode) error {
+	return fs.apply("chmod", name, true, func(mounted FileSystem, path string) error {
+		return mounted.Chmod(path, mode)
+	})
+}
+
+func (fs *mountFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.apply("chtimes", name, true, func(mounted FileSystem, path string) error {
+		return mounted.Chtimes(path, atime, mtime)
+	})
+}
+
+func (fs *mountFilesystem) Chown(name string, uid, gid int) error {
+	return fs.apply("chown", name, true, func(mounted FileSystem, path string) error {
+		return mounted.Chown(path, uid, gid)
+	})
+}
+
+func (fs *mountFilesystem) Lchown(name string, uid, gid int) error {
+	return fs.apply("lchown", name, false, func(mounted FileSystem, path string) error {
+		return mounted.Lchown(path, uid, gid)
+	})
+}
+
+func (fs *mountFilesystem) Truncate(name string, size int64) error {
+	return fs.apply("truncate", name, true, func(mounted FileSystem, path string) error {
+		return mounted.Truncate(path, size)
+	})
+}
+
+func (fs *mountFilesystem) Mkdir(name string, perm os.FileMode) error {
+	return fs.apply("mkdir", name, false, func(mounted FileSystem, path string) error {
+		return mounted.Mkdir(path, perm)
+	})
+}
+
+func (fs *mountFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	return mkdirAll(fs, path, perm)
+}
+
+func (fs *mountFilesystem) Readlink(name string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, mounted, inner, err := fs.path(name, false)
+	if err != nil {
+		return "", opError("readlink", name, err)
+	}
+	target, err := mounted.Readlink(inner)
+	if err != nil {
+		return "", pathErr("readlink", name, err)
+	}
+	return target, nil
+}
+
+func (fs *mountFilesystem) Symlink(oldname, newname string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	// The target means the same in the combined namespace as it did to the
+	// caller, so it's stored as is.
+	_, mounted, inner, err := fs.path(newname, false)
+	if err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	if err := mounted.Symlink(oldname, inner); err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	return nil
+}
+
+func (fs *mountFilesystem) Link(oldname, newname string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	srcPoint, src, srcInner, err := fs.path(oldname, false)
+	if err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	dstPoint, _, dstInner, err := fs.path(newname, false)
+	if err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	if srcPoint != dstPoint {
+		return linkError("link", oldname, newname, syscall.EXDEV)
+	}
+	if err := src.Link(srcInner, dstInner); err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	return nil
+}
+
+func (fs *mountFilesystem) Open(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *mountFilesystem) Create(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(0666))
+}
+
+func (fs *mountFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	exclusive := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+	path, err := fs.resolve(name, !exclusive && flag&oNoFollow == 0)
+	if err != nil {
+		return nil, opError("open", name, err)
+	}
+	_, mounted, inner := fs.route(path)
+	if strings.HasSuffix(name, "/") && !strings.HasSuffix(inner, "/") {
+		inner += "/"
+	}
+	file, err := mounted.OpenFile(inner, flag, perm)
+	if err != nil {
+		return nil, pathErr("open", name, err)
+	}
+	renamed := &renamedFile{
+		File: file,
+		name: name,
+	}
+
+	// Directories with something mounted in them list the mount points too.
+	var mounts []os.FileInfo
+	for prefix, child := range fs.mounts {
+		if prefix != "/" && filepath.Dir(prefix) == path {
+			info, err := child.Stat("/")
+			if err != nil {
+				file.Close()
+				return nil, pathErr("open", name, err)
+			}
+			mounts = append(mounts, &renamedInfo{info, filepath.Base(prefix)})
+		}
+	}
+	if mounts == nil {
+		return renamed, nil
+	}
+	slices.SortFunc(mounts, func(a, b os.FileInfo) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return &mountDir{
+		renamedFile: renamed,
+		mounts:      mounts,
+	}, nil
+}
+
+func (fs *mountFilesystem) Remove(name string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, mounted, inner, err := fs.removable(name)
+	if err != nil {
+		return opError("remove", name, err)
+	}
+	if err := mounted.Remove(inner); err != nil {
+		return pathErr("remove", name, err)
+	}
+	return nil
+}
+
+func (fs *mountFilesystem) RemoveAll(name string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, mounted, inner, err := fs.removable(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return opError("RemoveAll", name, err)
+	}
+	if err := mounted.RemoveAll(inner); err != nil {
+		return pathErr("RemoveAll", name, err)
+	}
+	return nil
+}
+
+func (fs *mountFilesystem) Rename(oldpath, newpath string) error {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	srcPoint, src, srcInner, err := fs.removable(oldpath)
+	if err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	dstPoint, _, dstInner, err := fs.removable(newpath)
+	if err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	if srcPoint != dstPoint {
+		return linkError("rename", oldpath, newpath, syscall.EXDEV)
+	}
+	if err := src.Rename(srcInner, dstInner); err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	return nil
+}
+
+// mountDir is a directory with file systems mounted in it. Listing it shows
+// the mount points in place of anything they hide.
+type mountDir struct {
+	*renamedFile
+
+	// The roots of the file systems mounted in the directory, named after
+	// their mount points.
+	mounts []os.FileInfo
+
+	// mu guards the entries that are still to be read, which are all listed
+	// on the first read.
+	mu      sync.Mutex
+	entries []os.FileInfo
+	listed  bool
+}
+
+// readdir returns the next n entries in the directory, or all the rest if
+// n <= 0, with the same cursor semantics as mockFile.
+func (f *mountDir) readdir(n int) ([]os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.listed {
+		infos, err := f.renamedFile.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			_, hidden := slices.BinarySearchFunc(f.mounts, info.Name(), func(mount os.FileInfo, name string) int {
+				return strings.Compare(mount.Name(), name)
+			})
+			if !hidden {
+				f.entries = append(f.entries, info)
+			}
+		}
+		f.entries = append(f.entries, f.mounts...)
+		f.listed = true
+	}
+
+	var ret []os.FileInfo
+	for len(f.entries) > 0 && (n <= 0 || len(ret) < n) {
+		ret = append(ret, f.entries[0])
+		f.entries = f.entries[1:]
+	}
+	if n > 0 && len(ret) == 0 {
+		return nil, io.EOF
+	}
+	return ret, nil
+}
+
+func (f *mountDir) Readdir(n int) ([]os.FileInfo, error) {
+	return f.readdir(n)
+}
+
+func (f *mountDir) Readdirnames(n int) ([]string, error) {
+	infos, err := f.readdir(n)
+	ret := make([]string, len(infos))
+	for i, info := range infos {
+		ret[i] = info.Name()
+	}
+	return ret, err
+}
+
+func (f *mountDir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	infos, err := f.readdir(n)
+	ret := make([]iofs.DirEntry, len(infos))
+	for i, info := range infos {
+		ret[i] = iofs.FileInfoToDirEntry(info)
+	}
+	return ret, err
+}
+
+func (f *mountDir) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.renamedFile.Seek(offset, whence)
+	if err == nil && offset == 0 && whence == io.SeekStart {
+		f.mu.Lock()
+		f.entries = nil
+		f.listed = false
+		f.mu.Unlock()
+	}
+	return pos, err
+}
@@ -0,0 +1,165 @@
+package gofs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMountFs(t *testing.T) {
+	root := MockFs()
+	root.MkdirAll("/etc", os.FileMode(0755))
+	WriteFile(root, "/etc/hosts", []byte("localhost"), os.FileMode(0644))
+	root.Symlink("/etc/app/conf", "/conf")
+
+	scratch := MockFs()
+	fs := MountFs(root)
+	if err := fs.Mount("/etc/app", IoFs(fstest.MapFS{
+		"conf": {Data: []byte("embedded"), Mode: 0644},
+	})); err != nil {
+		t.Fatalf("Unexpected error from Mount: %v", err)
+	}
+	if err := fs.Mount("/tmp", scratch); err != nil {
+		t.Fatalf("Unexpected error from Mount: %v", err)
+	}
+
+	testReadFile(t, fs, "/etc/hosts", "localhost")
+	testReadFile(t, fs, "/etc/app/conf", "embedded")
+	testReadFile(t, fs, "/conf", "embedded")
+
+	t.Run("Routing", func(t *testing.T) {
+		WriteFile(fs, "/tmp/scratch", []byte("scratch"), os.FileMode(0644))
+		testReadFile(t, scratch, "/scratch", "scratch")
+		testFileExists(t, root, "/tmp/scratch", false)
+
+		err := WriteFile(fs, "/etc/app/new", []byte("new"), os.FileMode(0644))
+		testReadOnly(t, "Write", err)
+	})
+
+	t.Run("Readdir", func(t *testing.T) {
+		if names := readdirnames(t, fs, "/"); names != "conf,etc,tmp" {
+			t.Fatalf("Unexpected names: '%v'", names)
+		}
+		info, err := fs.Stat("/tmp")
+		if err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		if info.Name() != "tmp" || !info.IsDir() {
+			t.Fatalf("Unexpected info: %v, %v", info.Name(), info.Mode())
+		}
+	})
+
+	t.Run("Chdir", func(t *testing.T) {
+		if err := fs.Chdir("/etc/app"); err != nil {
+			t.Fatalf("Unexpected error from Chdir: %v", err)
+		}
+		defer fs.Chdir("/")
+
+		wd, err := fs.Getwd()
+		if err != nil {
+			t.Fatalf("Unexpected error from Getwd: %v", err)
+		}
+		if wd != "/etc/app" {
+			t.Fatalf("Unexpected working directory: '%v'", wd)
+		}
+		abs, err := fs.Abs("conf")
+		if err != nil {
+			t.Fatalf("Unexpected error from Abs: %v", err)
+		}
+		if abs != "/etc/app/conf" {
+			t.Fatalf("Unexpected path: '%v'", abs)
+		}
+		testReadFile(t, fs, "conf", "embedded")
+		// ".." leads out of the mount.
+		testReadFile(t, fs, "../hosts", "localhost")
+	})
+
+	t.Run("CrossDevice", func(t *testing.T) {
+		if err := fs.Rename("/etc/hosts", "/tmp/hosts"); !errors.Is(err, syscall.EXDEV) {
+			t.Fatalf("Expected EXDEV from Rename, got '%v'", err)
+		}
+		if err := fs.Link("/etc/hosts", "/tmp/hosts"); !errors.Is(err, syscall.EXDEV) {
+			t.Fatalf("Expected EXDEV from Link, got '%v'", err)
+		}
+	})
+
+	t.Run("Busy", func(t *testing.T) {
+		if err := fs.Remove("/tmp"); !errors.Is(err, syscall.EBUSY) {
+			t.Fatalf("Expected EBUSY from Remove, got '%v'", err)
+		}
+		if err := fs.RemoveAll("/etc"); !errors.Is(err, syscall.EBUSY) {
+			t.Fatalf("Expected EBUSY from RemoveAll, got '%v'", err)
+		}
+		if err := fs.Rename("/tmp", "/scratch"); !errors.Is(err, syscall.EBUSY) {
+			t.Fatalf("Expected EBUSY from Rename, got '%v'", err)
+		}
+	})
+
+	t.Run("Dot", func(t *testing.T) {
+		fs.MkdirAll("/tmp/dir/sub", os.FileMode(0755))
+		WriteFile(fs, "/tmp/dir/file", []byte("file"), os.FileMode(0644))
+		if err := fs.Chdir("/tmp/dir/sub"); err != nil {
+			t.Fatalf("Unexpected error from Chdir: %v", err)
+		}
+		defer fs.Chdir("/")
+
+		if err := fs.RemoveAll("."); !errors.Is(err, syscall.EINVAL) {
+			t.Fatalf("Expected EINVAL from RemoveAll, got '%v'", err)
+		}
+		if err := fs.RemoveAll(".."); !errors.Is(err, syscall.EINVAL) {
+			t.Fatalf("Expected EINVAL from RemoveAll, got '%v'", err)
+		}
+		if err := fs.Remove("."); !errors.Is(err, syscall.EINVAL) {
+			t.Fatalf("Expected EINVAL from Remove, got '%v'", err)
+		}
+		if err := fs.Rename("..", "/tmp/moved"); !errors.Is(err, syscall.EINVAL) {
+			t.Fatalf("Expected EINVAL from Rename, got '%v'", err)
+		}
+		testReadFile(t, fs, "/tmp/dir/file", "file")
+	})
+
+	t.Run("Unmount", func(t *testing.T) {
+		if err := fs.Unmount("/tmp"); err != nil {
+			t.Fatalf("Unexpected error from Unmount: %v", err)
+		}
+		testDirExists(t, fs, "/tmp", false)
+		if err := fs.Unmount("/tmp"); !errors.Is(err, syscall.EINVAL) {
+			t.Fatalf("Expected EINVAL, got '%v'", err)
+		}
+	})
+}
+
+// unhashableFs is a FileSystem that panics if compared with ==.
+type unhashableFs struct {
+	FileSystem
+	_ []string
+}
+
+func TestMountFsUnhashable(t *testing.T) {
+	fs := MountFs(MockFs())
+	fs.MkdirAll("/a", os.FileMode(0755))
+	fs.MkdirAll("/b", os.FileMode(0755))
+	if err := fs.Mount("/a", unhashableFs{FileSystem: MockFs()}); err != nil {
+		t.Fatalf("Unexpected error from Mount: %v", err)
+	}
+	if err := fs.Mount("/b", unhashableFs{FileSystem: MockFs()}); err != nil {
+		t.Fatalf("Unexpected error from Mount: %v", err)
+	}
+	WriteFile(fs, "/a/one", []byte("one"), os.FileMode(0644))
+
+	if err := fs.Rename("/a/one", "/b/one"); !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("Expected EXDEV from Rename, got '%v'", err)
+	}
+	if err := fs.Link("/a/one", "/b/one"); !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("Expected EXDEV from Link, got '%v'", err)
+	}
+	if err := fs.Rename("/a/one", "/a/two"); err != nil {
+		t.Fatalf("Unexpected error from Rename: %v", err)
+	}
+	if err := fs.Link("/a/two", "/a/three"); err != nil {
+		t.Fatalf("Unexpected error from Link: %v", err)
+	}
+	testReadFile(t, fs, "/a/three", "one")
+}
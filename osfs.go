@@ -2,6 +2,7 @@ package gofs
 
 import "os"
 import "path/filepath"
+import "time"
 
 type osFilesystem struct {
 }
@@ -31,6 +32,18 @@ func (osFilesystem) Chmod(name string, mode os.FileMode) error {
 	return os.Chmod(name, mode)
 }
 
+func (osFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (osFilesystem) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (osFilesystem) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
 func (osFilesystem) Lstat(name string) (os.FileInfo, error) {
 	return os.Lstat(name)
 }
@@ -43,6 +56,10 @@ func (osFilesystem) Symlink(oldname, newname string) error {
 	return os.Symlink(oldname, newname)
 }
 
+func (osFilesystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
 func (osFilesystem) Open(name string) (File, error) {
 	return os.Open(name)
 }
@@ -0,0 +1,762 @@
+package gofs
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type overlayFilesystem struct {
+	lower FileSystem
+	upper FileSystem
+
+	// mu guards cwd and hidden, and makes each method atomic with respect to
+	// the others.
+	mu  sync.RWMutex
+	cwd string
+
+	// The paths where something in the lower layer has been removed or
+	// replaced, hiding it and everything beneath it. This does the job of
+	// both whiteouts and opaque directories in overlayfs.
+	hidden map[string]bool
+}
+
+// Overlay creates a copy-on-write FileSystem that layers upper over lower, like
+// Linux's overlayfs. Reads are served from upper where it has a file, and from
+// lower otherwise; directories list the entries from both. Anything that would
+// modify a file in lower copies it, and the directories above it, into upper
+// first, and removing something from lower only hides it, so lower is never
+// modified. Both layers must use the same absolute paths.
+//
+// Symlinks are resolved in the combined view, so a link in one layer can lead
+// into the other. Files copied up keep their mode and modification time, but
+// not their owner, and hard links in lower are broken up one name at a time.
+func Overlay(lower, upper FileSystem) FileSystem {
+	return &overlayFilesystem{
+		lower:  lower,
+		upper:  upper,
+		cwd:    "/",
+		hidden: map[string]bool{},
+	}
+}
+
+func (fs *overlayFilesystem) abs(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(fs.cwd, path)
+}
+
+// lowerVisible returns whether the lower layer can be seen at path.
+func (fs *overlayFilesystem) lowerVisible(path string) bool {
+	for {
+		if fs.hidden[path] {
+			return false
+		}
+		if path == "/" {
+			return true
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// inLower returns whether there's something visible at path in the lower
+// layer, whether or not the upper layer covers it.
+func (fs *overlayFilesystem) inLower(path string) bool {
+	if !fs.lowerVisible(path) {
+		return false
+	}
+	_, err := fs.lower.Lstat(path)
+	return err == nil
+}
+
+// hide hides path, and everything beneath it, in the lower layer. Any paths
+// beneath it that were already hidden no longer need to be.
+func (fs *overlayFilesystem) hide(path string) {
+	for hidden := range fs.hidden {
+		if strings.HasPrefix(hidden, path+"/") {
+			delete(fs.hidden, hidden)
+		}
+	}
+	fs.hidden[path] = true
+}
+
+// uncover stops hiding path once something has been created there in the
+// upper layer, which covers whatever lower has there by itself. The exception
+// is a directory in lower, whose contents have to stay hidden.
+func (fs *overlayFilesystem) uncover(path string) {
+	if !fs.hidden[path] {
+		return
+	}
+	if info, err := fs.lower.Lstat(path); err == nil && info.IsDir() {
+		return
+	}
+	delete(fs.hidden, path)
+}
+
+// lookup finds the layer holding path, which must not go through any symlinks,
+// and returns whether it's the upper one along with the Lstat of path in it.
+// The layers themselves needn't be comparable, so callers go by the flag.
+func (fs *overlayFilesystem) lookup(path string) (bool, os.FileInfo, error) {
+	info, err := fs.upper.Lstat(path)
+	if err == nil {
+		return true, info, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) || !fs.lowerVisible(path) {
+		return false, nil, err
+	}
+	info, err = fs.lower.Lstat(path)
+	if err != nil {
+		return false, nil, err
+	}
+	return false, info, nil
+}
+
+// layer returns the upper layer if upper is set, or else the lower one.
+func (fs *overlayFilesystem) layer(upper bool) FileSystem {
+	if upper {
+		return fs.upper
+	}
+	return fs.lower
+}
+
+// resolve turns path into an absolute path with no symlinks in it, so that it
+// means the same thing in both layers.
+func (fs *overlayFilesystem) resolve(path string, follow bool) (string, error) {
+	r := resolver{
+		lstat: func(path string) (os.FileInfo, error) {
+			_, info, err := fs.lookup(path)
+			return info, err
+		},
+		readlink: fs.readlink,
+	}
+	return r.resolve(fs.cwd, path, follow)
+}
+
+// readlink reads the symlink at path, which must not go through any symlinks,
+// from whichever layer holds it.
+func (fs *overlayFilesystem) readlink(path string) (string, error) {
+	upper, _, err := fs.lookup(path)
+	if err != nil {
+		return "", err
+	}
+	return fs.layer(upper).Readlink(path)
+}
+
+// list returns the sorted names in the directory at path, merged from both
+// layers.
+func (fs *overlayFilesystem) list(path string) ([]string, error) {
+	seen := map[string]bool{}
+	var names []string
+	for _, upper := range []bool{true, false} {
+		if !upper && !fs.lowerVisible(path) {
+			continue
+		}
+		layer := fs.layer(upper)
+		if info, err := layer.Lstat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		infos, err := ReadDir(layer, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if seen[name] || (!upper && fs.hidden[filepath.Join(path, name)]) {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// copyUp copies path, which must not go through any symlinks, from the lower
+// layer to the upper one, along with any of the directories above it that
+// upper doesn't have yet. It does nothing if upper already has path.
+func (fs *overlayFilesystem) copyUp(path string) error {
+	upper, info, err := fs.lookup(path)
+	if err != nil || upper {
+		return err
+	}
+	if err := fs.copyUp(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		err = fs.upper.Mkdir(path, info.Mode().Perm())
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := fs.lower.Readlink(path)
+		if err != nil {
+			return err
+		}
+		// There's no changing the mode or times of a symlink.
+		return fs.upper.Symlink(target, path)
+	default:
+		err = fs.copyFile(path, info.Mode().Perm())
+	}
+	if err != nil {
+		return err
+	}
+	if err := fs.upper.Chmod(path, info.Mode()&chmodMask); err != nil {
+		return err
+	}
+	return fs.upper.Chtimes(path, info.ModTime(), info.ModTime())
+}
+
+// copyFile copies the contents of the regular file at path from the lower
+// layer to a new file in the upper one.
+func (fs *overlayFilesystem) copyFile(path string, perm os.FileMode) error {
+	src, err := fs.lower.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := fs.upper.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// copyUpTree copies path and everything beneath it up to the upper layer, so
+// that it can be moved as a whole.
+func (fs *overlayFilesystem) copyUpTree(path string) error {
+	if err := fs.copyUp(path); err != nil {
+		return err
+	}
+	info, err := fs.upper.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+	names, err := fs.list(path)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := fs.copyUpTree(filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stat is Stat and Lstat.
+func (fs *overlayFilesystem) stat(op string, name string, follow bool) (os.FileInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	path, err := fs.resolve(name, follow)
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+	_, info, err := fs.lookup(path)
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+	if base := filepath.Base(name); info.Name() != base {
+		// The layer named it after where the symlinks led.
+		info = &renamedInfo{info, base}
+	}
+	return info, nil
+}
+
+func (fs *overlayFilesystem) Stat(name string) (os.FileInfo, error) {
+	return fs.stat("stat", name, true)
+}
+
+func (fs *overlayFilesystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.stat("lstat", name, false)
+}
+
+func (fs *overlayFilesystem) Getwd() (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.cwd, nil
+}
+
+func (fs *overlayFilesystem) Chdir(dir string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.resolve(dir, true)
+	if err != nil {
+		return opError("chdir", dir, err)
+	}
+	_, info, err := fs.lookup(path)
+	if err != nil {
+		return opError("chdir", dir, err)
+	}
+	if !info.IsDir() {
+		return &os.PathError{
+			Op:   "chdir",
+			Err:  syscall.ENOTDIR,
+			Path: dir,
+		}
+	}
+	fs.cwd = path
+	return nil
+}
+
+func (fs *overlayFilesystem) Abs(path string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.abs(path), nil
+}
+
+// modify copies the file name refers to up to the upper layer, then applies
+// change to the copy.
+func (fs *overlayFilesystem) modify(op string, name string, follow bool, change func(path string) error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.resolve(name, follow)
+	if err != nil {
+		return opError(op, name, err)
+	}
+	if err := fs.copyUp(path); err != nil {
+		return opError(op, name, err)
+	}
+	if err := change(path); err != nil {
+		return opError(op, name, err)
+	}
+	return nil
+}
+
+func (fs *overlayFilesystem) Chmod(name string, mode os.FileMode) error {
+	return fs.modify("chmod", name, true, func(path string) error {
+		return fs.upper.Chmod(path, mode)
+	})
+}
+
+func (fs *overlayFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fs.modify("chtimes", name, true, func(path string) error {
+		return fs.upper.Chtimes(path, atime, mtime)
+	})
+}
+
+func (fs *overlayFilesystem) Chown(name string, uid, gid int) error {
+	return fs.modify("chown", name, true, func(path string) error {
+		return fs.upper.Chown(path, uid, gid)
+	})
+}
+
+func (fs *overlayFilesystem) Lchown(name string, uid, gid int) error {
+	return fs.modify("lchown", name, false, func(path string) error {
+		return fs.upper.Lchown(path, uid, gid)
+	})
+}
+
+func (fs *overlayFilesystem) Truncate(name string, size int64) error {
+	return fs.modify("truncate", name, true, func(path string) error {
+		return fs.upper.Truncate(path, size)
+	})
+}
+
+func (fs *overlayFilesystem) Readlink(name string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	path, err := fs.resolve(name, false)
+	if err != nil {
+		return "", opError("readlink", name, err)
+	}
+	target, err := fs.readlink(path)
+	if err != nil {
+		return "", opError("readlink", name, err)
+	}
+	return target, nil
+}
+
+// create resolves name for creating something new, checking that nothing is
+// there already and copying the directory it'll go in up to the upper layer.
+func (fs *overlayFilesystem) create(name string) (string, error) {
+	path, err := fs.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+	_, _, err = fs.lookup(path)
+	if err == nil {
+		return "", syscall.EEXIST
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if err := fs.copyUp(filepath.Dir(path)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (fs *overlayFilesystem) Symlink(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.create(newname)
+	if err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	if err := fs.upper.Symlink(oldname, path); err != nil {
+		return linkError("symlink", oldname, newname, err)
+	}
+	fs.uncover(path)
+	return nil
+}
+
+func (fs *overlayFilesystem) Link(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	oldpath, err := fs.resolve(oldname, false)
+	if err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	_, info, err := fs.lookup(oldpath)
+	if err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	if info.IsDir() {
+		return linkError("link", oldname, newname, syscall.EPERM)
+	}
+	newpath, err := fs.create(newname)
+	if err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	if err := fs.copyUp(oldpath); err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	if err := fs.upper.Link(oldpath, newpath); err != nil {
+		return linkError("link", oldname, newname, err)
+	}
+	fs.uncover(newpath)
+	return nil
+}
+
+func (fs *overlayFilesystem) Mkdir(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.create(name)
+	if err != nil {
+		return opError("mkdir", name, err)
+	}
+	if err := fs.upper.Mkdir(path, perm); err != nil {
+		return opError("mkdir", name, err)
+	}
+	fs.uncover(path)
+	return nil
+}
+
+func (fs *overlayFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	return mkdirAll(fs, path, perm)
+}
+
+func (fs *overlayFilesystem) Open(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *overlayFilesystem) Create(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(0666))
+}
+
+func (fs *overlayFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	exclusive := flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL
+	path, err := fs.resolve(name, !exclusive && flag&oNoFollow == 0)
+	if err != nil {
+		return nil, opError("open", name, err)
+	}
+
+	upper, info, err := fs.lookup(path)
+	switch {
+	case err == nil:
+		if exclusive {
+			return nil, &os.PathError{
+				Op:   "open",
+				Err:  syscall.EEXIST,
+				Path: name,
+			}
+		}
+		write := flag&(os.O_RDONLY|os.O_WRONLY|os.O_RDWR) != os.O_RDONLY || flag&os.O_TRUNC != 0
+		if !upper && write && info.Mode().IsRegular() {
+			if err := fs.copyUp(path); err != nil {
+				return nil, opError("open", name, err)
+			}
+			upper = true
+		}
+		if !upper {
+			// Whatever it is already exists, and lower may well be read-only.
+			flag &^= os.O_CREATE
+		}
+	case errors.Is(err, os.ErrNotExist) && flag&os.O_CREATE != 0:
+		if strings.HasSuffix(name, "/") {
+			return nil, &os.PathError{
+				Op:   "open",
+				Err:  syscall.EISDIR,
+				Path: name,
+			}
+		}
+		if err := fs.copyUp(filepath.Dir(path)); err != nil {
+			return nil, opError("open", name, err)
+		}
+		upper = true
+	default:
+		return nil, opError("open", name, err)
+	}
+
+	file, err := fs.layer(upper).OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, opError("open", name, err)
+	}
+	if info == nil {
+		fs.uncover(path)
+	}
+	return &overlayFile{
+		File: file,
+		name: name,
+		fs:   fs,
+		path: path,
+		dir:  info != nil && info.IsDir(),
+	}, nil
+}
+
+func (fs *overlayFilesystem) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	path, err := fs.resolve(name, false)
+	if err != nil {
+		return opError("remove", name, err)
+	}
+	upper, info, err := fs.lookup(path)
+	if err != nil {
+		return opError("remove", name, err)
+	}
+	switch filepath.Base(filepath.Clean(name)) {
+	case ".", "/":
+		return opError("remove", name, syscall.EINVAL)
+	case "..":
+		return opError("remove", name, syscall.ENOTEMPTY)
+	}
+
+	if info.IsDir() {
+		names, err := fs.list(path)
+		if err != nil {
+			return opError("remove", name, err)
+		}
+		if len(names) != 0 {
+			return opError("remove", name, syscall.ENOTEMPTY)
+		}
+	}
+	if upper {
+		if err := fs.upper.Remove(path); err != nil {
+			return opError("remove", name, err)
+		}
+	}
+	if fs.inLower(path) {
+		fs.hide(path)
+	}
+	return nil
+}
+
+func (fs *overlayFilesystem) RemoveAll(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if base := filepath.Base(name); base == "." || base == ".." {
+		return opError("RemoveAll", name, syscall.EINVAL)
+	}
+	path, err := fs.resolve(name, false)
+	if err == nil {
+		_, _, err = fs.lookup(path)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return opError("RemoveAll", name, err)
+	}
+
+	if err := fs.upper.RemoveAll(path); err != nil {
+		return opError("RemoveAll", name, err)
+	}
+	if fs.inLower(path) {
+		fs.hide(path)
+	}
+	return nil
+}
+
+func (fs *overlayFilesystem) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	src, err := fs.resolve(oldpath, false)
+	if err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	_, srcInfo, err := fs.lookup(src)
+	if err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	dst, err := fs.resolve(newpath, false)
+	if err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	_, dstInfo, err := fs.lookup(dst)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return linkError("rename", oldpath, newpath, err)
+	}
+
+	// These checks follow os.Rename, which refuses to replace a directory.
+	switch {
+	case dstInfo != nil && dstInfo.IsDir() && (oldpath == newpath || src != dst):
+		return linkError("rename", oldpath, newpath, syscall.EEXIST)
+	case src == dst:
+		return nil
+	case srcInfo.IsDir() && dstInfo != nil:
+		return linkError("rename", oldpath, newpath, syscall.ENOTDIR)
+	case srcInfo.IsDir() && strings.HasPrefix(dst, src+"/"):
+		return linkError("rename", oldpath, newpath, syscall.EINVAL)
+	}
+
+	if err := fs.copyUpTree(src); err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	if err := fs.copyUp(filepath.Dir(dst)); err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	if err := fs.upper.Rename(src, dst); err != nil {
+		return linkError("rename", oldpath, newpath, err)
+	}
+	if fs.inLower(src) {
+		fs.hide(src)
+	}
+	fs.uncover(dst)
+	return nil
+}
+
+// overlayFile is a File opened through an overlay. Everything but listing a
+// directory goes straight to the file in whichever layer it was opened from.
+type overlayFile struct {
+	File
+	name string
+
+	// The overlay and the resolved path, for listing directories.
+	fs   *overlayFilesystem
+	path string
+	dir  bool
+
+	// mu guards the directory cursor, and closed.
+	mu     sync.Mutex
+	names  []string
+	listed bool
+	closed bool
+}
+
+func (f *overlayFile) Name() string {
+	return f.name
+}
+
+// readdir returns the next n entries in the directory from both layers, or all
+// the rest if n <= 0, with the same cursor semantics as mockFile.
+func (f *overlayFile) readdir(n int) ([]os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, &os.PathError{
+			Op:   "readdirent",
+			Err:  os.ErrClosed,
+			Path: f.name,
+		}
+	}
+
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if !f.listed {
+		names, err := f.fs.list(f.path)
+		if err != nil {
+			return nil, opError("readdirent", f.name, err)
+		}
+		f.names = names
+		f.listed = true
+	}
+	var ret []os.FileInfo
+	for len(f.names) > 0 && (n <= 0 || len(ret) < n) {
+		name := f.names[0]
+		f.names = f.names[1:]
+		// Anything removed since the directory was listed is skipped.
+		if _, info, err := f.fs.lookup(filepath.Join(f.path, name)); err == nil {
+			ret = append(ret, info)
+		}
+	}
+	if n > 0 && len(ret) == 0 {
+		return nil, io.EOF
+	}
+	return ret, nil
+}
+
+func (f *overlayFile) Readdir(n int) ([]os.FileInfo, error) {
+	if !f.dir {
+		return f.File.Readdir(n)
+	}
+	return f.readdir(n)
+}
+
+func (f *overlayFile) Readdirnames(n int) ([]string, error) {
+	if !f.dir {
+		return f.File.Readdirnames(n)
+	}
+	infos, err := f.readdir(n)
+	ret := make([]string, len(infos))
+	for i, info := range infos {
+		ret[i] = info.Name()
+	}
+	return ret, err
+}
+
+func (f *overlayFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if !f.dir {
+		return f.File.ReadDir(n)
+	}
+	infos, err := f.readdir(n)
+	ret := make([]iofs.DirEntry, len(infos))
+	for i, info := range infos {
+		ret[i] = iofs.FileInfoToDirEntry(info)
+	}
+	return ret, err
+}
+
+func (f *overlayFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil && f.dir && offset == 0 && whence == io.SeekStart {
+		f.mu.Lock()
+		f.names = nil
+		f.listed = false
+		f.mu.Unlock()
+	}
+	return pos, err
+}
+
+func (f *overlayFile) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	return f.File.Close()
+}
@@ -0,0 +1,243 @@
+package gofs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// tree describes everything under root, so that tests can check it hasn't
+// changed.
+func tree(t *testing.T, fs FileSystem, root string) string {
+	var b strings.Builder
+	var walk func(path string)
+	walk = func(path string) {
+		infos, err := ReadDir(fs, path)
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadDir: %v", err)
+		}
+		for _, info := range infos {
+			child := filepath.Join(path, info.Name())
+			fmt.Fprintf(&b, "%v %v", strings.TrimPrefix(child, root), info.Mode())
+			switch {
+			case info.IsDir():
+				walk(child)
+			case info.Mode()&os.ModeSymlink != 0:
+				target, _ := fs.Readlink(child)
+				fmt.Fprintf(&b, " -> %v", target)
+			default:
+				data, _ := ReadFile(fs, child)
+				fmt.Fprintf(&b, " %q", data)
+			}
+			b.WriteString("\n")
+		}
+	}
+	walk(root)
+	return b.String()
+}
+
+func TestOverlay(t *testing.T) {
+	root := t.TempDir()
+	lower := OsFs()
+	populateDirFs(lower, root)
+	lower.Symlink("foo", root+"/link")
+	before := tree(t, lower, root)
+
+	upper := MockFs()
+	fs := Overlay(lower, upper)
+
+	testReadFile(t, fs, root+"/hello", "Hello World")
+	testReadFile(t, fs, root+"/link/bar/two", "two")
+
+	t.Run("CopyUp", func(t *testing.T) {
+		f, err := fs.OpenFile(root+"/foo/one", os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatalf("Unexpected error from OpenFile: %v", err)
+		}
+		f.Write([]byte(" two"))
+		f.Close()
+
+		testReadFile(t, fs, root+"/foo/one", "one two")
+		testReadFile(t, upper, root+"/foo/one", "one two")
+		// The link in lower leads to the copy in upper.
+		testReadFile(t, fs, root+"/link/one", "one two")
+
+		info, err := upper.Stat(root + "/foo/bar")
+		if err == nil {
+			t.Fatalf("Copied up a sibling: %v", info.Name())
+		}
+		info, err = upper.Stat(root + "/foo")
+		if err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		if info.Mode() != os.ModeDir|0755 {
+			t.Fatalf("Unexpected mode: %v", info.Mode())
+		}
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		if err := fs.Chmod(root+"/foo/bar/two", 0640); err != nil {
+			t.Fatalf("Unexpected error from Chmod: %v", err)
+		}
+		info, err := fs.Stat(root + "/link/bar/two")
+		if err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		if info.Mode() != 0640 {
+			t.Fatalf("Unexpected mode: %v", info.Mode())
+		}
+		testReadFile(t, fs, root+"/foo/bar/two", "two")
+	})
+
+	t.Run("Whiteout", func(t *testing.T) {
+		if err := fs.Remove(root + "/hello"); err != nil {
+			t.Fatalf("Unexpected error from Remove: %v", err)
+		}
+		if _, err := fs.Stat(root + "/hello"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Expected ErrNotExist, got '%v'", err)
+		}
+
+		// A new file in its place doesn't bring the old one back.
+		WriteFile(fs, root+"/hello", []byte("Hi"), 0644)
+		testReadFile(t, fs, root+"/hello", "Hi")
+	})
+
+	t.Run("Opaque", func(t *testing.T) {
+		if err := fs.RemoveAll(root + "/foo"); err != nil {
+			t.Fatalf("Unexpected error from RemoveAll: %v", err)
+		}
+		if err := fs.Mkdir(root+"/foo", 0755); err != nil {
+			t.Fatalf("Unexpected error from Mkdir: %v", err)
+		}
+		if names := readdirnames(t, fs, root+"/foo"); names != "" {
+			t.Fatalf("Lower entries showed through: '%v'", names)
+		}
+		WriteFile(fs, root+"/foo/new", []byte("new"), 0644)
+		testReadFile(t, fs, root+"/link/new", "new")
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		WriteFile(fs, root+"/added", []byte("added"), 0644)
+		if err := fs.Remove(root + "/empty"); err != nil {
+			t.Fatalf("Unexpected error from Remove: %v", err)
+		}
+		if names := readdirnames(t, fs, root); names != "added,foo,hello,link" {
+			t.Fatalf("Unexpected names: '%v'", names)
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		if err := fs.Rename(root+"/link", root+"/moved"); err != nil {
+			t.Fatalf("Unexpected error from Rename: %v", err)
+		}
+		testReadFile(t, fs, root+"/moved/new", "new")
+		if _, err := fs.Lstat(root + "/link"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Expected ErrNotExist, got '%v'", err)
+		}
+	})
+
+	if after := tree(t, lower, root); after != before {
+		t.Fatalf("Lower layer changed from:\n%v\nto:\n%v", before, after)
+	}
+}
+
+func TestOverlayRenameDir(t *testing.T) {
+	lower := MockFs()
+	populateDirFs(lower, "/root")
+	fs := Overlay(lower, MockFs())
+
+	if err := fs.Rename("/root/foo", "/root/baz"); err != nil {
+		t.Fatalf("Unexpected error from Rename: %v", err)
+	}
+	testReadFile(t, fs, "/root/baz/one", "one")
+	testReadFile(t, fs, "/root/baz/bar/two", "two")
+	testDirExists(t, fs, "/root/foo", false)
+	testReadFile(t, lower, "/root/foo/bar/two", "two")
+
+	// Making the directory again gives an empty one.
+	if err := fs.Mkdir("/root/foo", 0755); err != nil {
+		t.Fatalf("Unexpected error from Mkdir: %v", err)
+	}
+	if names := readdirnames(t, fs, "/root/foo"); names != "" {
+		t.Fatalf("Lower entries showed through: '%v'", names)
+	}
+}
+
+func TestOverlayWhiteouts(t *testing.T) {
+	lower := MockFs()
+	populateDirFs(lower, "/root")
+	fs := Overlay(lower, MockFs())
+	hidden := fs.(*overlayFilesystem).hidden
+
+	for range 2 {
+		if err := fs.Remove("/root/hello"); err != nil {
+			t.Fatalf("Unexpected error from Remove: %v", err)
+		}
+		testFileExists(t, fs, "/root/hello", false)
+		WriteFile(fs, "/root/hello", []byte("Hi"), 0644)
+		testReadFile(t, fs, "/root/hello", "Hi")
+	}
+	if err := fs.Remove("/root/hello"); err != nil {
+		t.Fatalf("Unexpected error from Remove: %v", err)
+	}
+	testFileExists(t, fs, "/root/hello", false)
+	if len(hidden) != 1 || !hidden["/root/hello"] {
+		t.Fatalf("Unexpected whiteouts: %v", hidden)
+	}
+
+	// A new file over a directory in lower still hides what was in it.
+	if err := fs.RemoveAll("/root/foo/bar"); err != nil {
+		t.Fatalf("Unexpected error from RemoveAll: %v", err)
+	}
+	WriteFile(fs, "/root/foo/bar", []byte("bar"), 0644)
+	if _, err := fs.Stat("/root/foo/bar/two"); err == nil {
+		t.Fatalf("Lower entries showed through")
+	}
+
+	// Removing a whole tree leaves one whiteout for it.
+	if err := fs.RemoveAll("/root"); err != nil {
+		t.Fatalf("Unexpected error from RemoveAll: %v", err)
+	}
+	if len(hidden) != 1 || !hidden["/root"] {
+		t.Fatalf("Unexpected whiteouts: %v", hidden)
+	}
+}
+
+func TestOverlayUnhashable(t *testing.T) {
+	lower := MockFs()
+	populateDirFs(lower, "/root")
+	fs := Overlay(unhashableFs{FileSystem: lower}, unhashableFs{FileSystem: MockFs()})
+
+	testReadFile(t, fs, "/root/foo/bar/two", "two")
+	WriteFile(fs, "/root/foo/bar/two", []byte("2"), 0644)
+	testReadFile(t, fs, "/root/foo/bar/two", "2")
+	testReadFile(t, lower, "/root/foo/bar/two", "two")
+	if err := fs.Remove("/root/hello"); err != nil {
+		t.Fatalf("Unexpected error from Remove: %v", err)
+	}
+	testFileExists(t, fs, "/root/hello", false)
+}
+
+func TestOverlayRemoveAllError(t *testing.T) {
+	lower := MockFs()
+	populateDirFs(lower, "/root")
+	upper := Faulty(MockFs(), Fault{
+		Op: "RemoveAll",
+		Err: &os.PathError{
+			Op:   "unlinkat",
+			Err:  syscall.EIO,
+			Path: "/root/foo",
+		},
+	})
+	fs := Overlay(lower, upper)
+
+	err := fs.RemoveAll("/root/foo")
+	var pe *os.PathError
+	if !errors.As(err, &pe) || pe.Op != "RemoveAll" || pe.Path != "/root/foo" || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Unexpected error from RemoveAll: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package gofs
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+type readOnlyFilesystem struct {
+	fs FileSystem
+}
+
+// ReadOnly wraps fs so that it can be read but not modified. Methods that would
+// modify it, including opening a file for writing, fail with syscall.EROFS, as
+// do writes through the Files it opens.
+func ReadOnly(fs FileSystem) FileSystem {
+	return &readOnlyFilesystem{fs: fs}
+}
+
+func (fs *readOnlyFilesystem) Stat(name string) (os.FileInfo, error) {
+	return fs.fs.Stat(name)
+}
+
+func (fs *readOnlyFilesystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.fs.Lstat(name)
+}
+
+func (fs *readOnlyFilesystem) Readlink(name string) (string, error) {
+	return fs.fs.Readlink(name)
+}
+
+func (fs *readOnlyFilesystem) Getwd() (string, error) {
+	return fs.fs.Getwd()
+}
+
+func (fs *readOnlyFilesystem) Chdir(dir string) error {
+	// Changing directory doesn't modify anything.
+	return fs.fs.Chdir(dir)
+}
+
+func (fs *readOnlyFilesystem) Abs(path string) (string, error) {
+	return fs.fs.Abs(path)
+}
+
+func (fs *readOnlyFilesystem) Chmod(name string, mode os.FileMode) error {
+	return readOnly("chmod", name)
+}
+
+func (fs *readOnlyFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return readOnly("chtimes", name)
+}
+
+func (fs *readOnlyFilesystem) Chown(name string, uid, gid int) error {
+	return readOnly("chown", name)
+}
+
+func (fs *readOnlyFilesystem) Lchown(name string, uid, gid int) error {
+	return readOnly("lchown", name)
+}
+
+func (fs *readOnlyFilesystem) Symlink(oldname, newname string) error {
+	return linkError("symlink", oldname, newname, syscall.EROFS)
+}
+
+func (fs *readOnlyFilesystem) Link(oldname, newname string) error {
+	return linkError("link", oldname, newname, syscall.EROFS)
+}
+
+func (fs *readOnlyFilesystem) Mkdir(path string, perm os.FileMode) error {
+	return readOnly("mkdir", path)
+}
+
+func (fs *readOnlyFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	return readOnlyMkdirAll(fs.fs, path)
+}
+
+func (fs *readOnlyFilesystem) Open(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *readOnlyFilesystem) Create(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(0666))
+}
+
+func (fs *readOnlyFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, readOnly("open", name)
+	}
+	file, err := fs.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{file}, nil
+}
+
+func (fs *readOnlyFilesystem) Truncate(name string, size int64) error {
+	return readOnly("truncate", name)
+}
+
+func (fs *readOnlyFilesystem) Remove(name string) error {
+	return readOnly("remove", name)
+}
+
+func (fs *readOnlyFilesystem) RemoveAll(path string) error {
+	return readOnly("RemoveAll", path)
+}
+
+func (fs *readOnlyFilesystem) Rename(oldpath, newpath string) error {
+	return linkError("rename", oldpath, newpath, syscall.EROFS)
+}
+
+// readOnlyFile is a File opened through ReadOnly. The underlying File is only
+// open for reading anyway, but this makes sure it says EROFS rather than
+// EBADF.
+type readOnlyFile struct {
+	File
+}
+
+func (f *readOnlyFile) Chmod(mode os.FileMode) error {
+	return readOnly("chmod", f.Name())
+}
+
+func (f *readOnlyFile) Write(b []byte) (int, error) {
+	return 0, readOnly("write", f.Name())
+}
+
+func (f *readOnlyFile) WriteAt(b []byte, off int64) (int, error) {
+	return 0, readOnly("write", f.Name())
+}
+
+func (f *readOnlyFile) Truncate(size int64) error {
+	return readOnly("truncate", f.Name())
+}
@@ -0,0 +1,56 @@
+package gofs
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	mfs := MockFs()
+	mfs.MkdirAll("/foo", os.FileMode(0755))
+	WriteFile(mfs, "/foo/hello", []byte("Hello World"), os.FileMode(0644))
+	mfs.Symlink("hello", "/foo/link")
+
+	fs := ReadOnly(mfs)
+	testReadFile(t, fs, "/foo/hello", "Hello World")
+	testReadFile(t, fs, "/foo/link", "Hello World")
+	if names := readdirnames(t, fs, "/foo"); names != "hello,link" {
+		t.Fatalf("Unexpected names: '%v'", names)
+	}
+
+	f, err := fs.Open("/foo/hello")
+	if err != nil {
+		t.Fatalf("Unexpected error from Open: %v", err)
+	}
+	defer f.Close()
+
+	_, err = fs.Create("/foo/new")
+	testReadOnly(t, "Create", err)
+	_, err = fs.OpenFile("/foo/hello", os.O_WRONLY, 0)
+	testReadOnly(t, "OpenFile", err)
+	testReadOnly(t, "Mkdir", fs.Mkdir("/foo/new", 0755))
+	testReadOnly(t, "MkdirAll", fs.MkdirAll("/foo/new/dir", 0755))
+	if err := fs.MkdirAll("/foo", 0755); err != nil {
+		t.Fatalf("Unexpected error from MkdirAll: %v", err)
+	}
+	testReadOnly(t, "Chmod", fs.Chmod("/foo/hello", 0600))
+	testReadOnlyLink(t, "Symlink", fs.Symlink("/foo/hello", "/foo/other"))
+	testReadOnlyLink(t, "Link", fs.Link("/foo/hello", "/foo/other"))
+	testReadOnly(t, "Truncate", fs.Truncate("/foo/hello", 0))
+	testReadOnly(t, "Remove", fs.Remove("/foo/hello"))
+	err = fs.RemoveAll("/foo")
+	testReadOnly(t, "RemoveAll", err)
+	if pe, ok := err.(*os.PathError); ok && pe.Op != "RemoveAll" {
+		t.Fatalf("Unexpected op: %v", pe.Op)
+	}
+	testReadOnlyLink(t, "Rename", fs.Rename("/foo/hello", "/foo/bye"))
+	_, err = f.Write([]byte("x"))
+	testReadOnly(t, "Write", err)
+	_, err = f.WriteAt([]byte("x"), 0)
+	testReadOnly(t, "File.WriteAt", err)
+	testReadOnly(t, "File.Truncate", f.Truncate(0))
+	testReadOnly(t, "File.Chmod", f.Chmod(0600))
+
+	testReadFile(t, mfs, "/foo/hello", "Hello World")
+	testFileExists(t, mfs, "/foo/new", false)
+}
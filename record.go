@@ -0,0 +1,403 @@
+package gofs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Call is a single call to a FileSystem or File, as recorded by Record.
+type Call struct {
+	// Op is the method called, named as for Fault.Op.
+	Op string `json:"op"`
+
+	// File identifies the File that a File method was called on, or that
+	// Open, Create or OpenFile returned. Files are numbered from 1 in the order
+	// they were opened.
+	File int `json:"file,omitempty"`
+
+	// The arguments, for methods that take them. Methods that take two paths
+	// put the first in Path and the second in NewPath. Len is the size of the
+	// buffer passed to reads and writes, or the count passed to Readdir, and
+	// Size is the size passed to Truncate.
+	Path    string      `json:"path,omitempty"`
+	NewPath string      `json:"newpath,omitempty"`
+	Flag    int         `json:"flag,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	Offset  int64       `json:"offset,omitempty"`
+	Whence  int         `json:"whence,omitempty"`
+	Len     int         `json:"len,omitempty"`
+	Size    int64       `json:"size,omitempty"`
+	UID     int         `json:"uid,omitempty"`
+	GID     int         `json:"gid,omitempty"`
+	Atime   time.Time   `json:"atime,omitzero"`
+	Mtime   time.Time   `json:"mtime,omitzero"`
+
+	// The results. N is the number of bytes read or written, the number of
+	// directory entries listed, the offset Seek moved to, or the size Stat
+	// found. Result is the string returned by Getwd, Abs or Readlink.
+	N      int64  `json:"n,omitempty"`
+	Result string `json:"result,omitempty"`
+	Err    string `json:"err,omitempty"`
+}
+
+// RecordingFs is a file system that records the calls made to it.
+type RecordingFs interface {
+	FileSystem
+
+	// Trace returns the calls made so far, in order.
+	Trace() []Call
+}
+
+type recordingFilesystem struct {
+	fs FileSystem
+
+	// mu guards calls and files, the number of Files opened so far.
+	mu    sync.Mutex
+	calls []Call
+	files int
+}
+
+// Record wraps fs, and the Files it opens, so that every call made to them is
+// recorded, with its arguments and the size of its results. The contents of
+// reads and writes aren't.
+func Record(fs FileSystem) RecordingFs {
+	return &recordingFilesystem{fs: fs}
+}
+
+func (fs *recordingFilesystem) Trace() []Call {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]Call(nil), fs.calls...)
+}
+
+// record adds a call to the trace, along with the error it returned.
+func (fs *recordingFilesystem) record(call Call, err error) {
+	if err != nil {
+		call.Err = err.Error()
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.calls = append(fs.calls, call)
+}
+
+// size returns the size recorded for a FileInfo.
+func size(info os.FileInfo) int64 {
+	if info == nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func (fs *recordingFilesystem) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.fs.Stat(name)
+	fs.record(Call{Op: "Stat", Path: name, N: size(info)}, err)
+	return info, err
+}
+
+func (fs *recordingFilesystem) Getwd() (string, error) {
+	dir, err := fs.fs.Getwd()
+	fs.record(Call{Op: "Getwd", Result: dir}, err)
+	return dir, err
+}
+
+func (fs *recordingFilesystem) Chdir(dir string) error {
+	err := fs.fs.Chdir(dir)
+	fs.record(Call{Op: "Chdir", Path: dir}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Abs(path string) (string, error) {
+	abs, err := fs.fs.Abs(path)
+	fs.record(Call{Op: "Abs", Path: path, Result: abs}, err)
+	return abs, err
+}
+
+func (fs *recordingFilesystem) Chmod(name string, mode os.FileMode) error {
+	err := fs.fs.Chmod(name, mode)
+	fs.record(Call{Op: "Chmod", Path: name, Mode: mode}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	err := fs.fs.Chtimes(name, atime, mtime)
+	fs.record(Call{Op: "Chtimes", Path: name, Atime: atime, Mtime: mtime}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Chown(name string, uid, gid int) error {
+	err := fs.fs.Chown(name, uid, gid)
+	fs.record(Call{Op: "Chown", Path: name, UID: uid, GID: gid}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Lchown(name string, uid, gid int) error {
+	err := fs.fs.Lchown(name, uid, gid)
+	fs.record(Call{Op: "Lchown", Path: name, UID: uid, GID: gid}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Lstat(name string) (os.FileInfo, error) {
+	info, err := fs.fs.Lstat(name)
+	fs.record(Call{Op: "Lstat", Path: name, N: size(info)}, err)
+	return info, err
+}
+
+func (fs *recordingFilesystem) Readlink(name string) (string, error) {
+	target, err := fs.fs.Readlink(name)
+	fs.record(Call{Op: "Readlink", Path: name, Result: target}, err)
+	return target, err
+}
+
+func (fs *recordingFilesystem) Symlink(oldname, newname string) error {
+	err := fs.fs.Symlink(oldname, newname)
+	fs.record(Call{Op: "Symlink", Path: oldname, NewPath: newname}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Link(oldname, newname string) error {
+	err := fs.fs.Link(oldname, newname)
+	fs.record(Call{Op: "Link", Path: oldname, NewPath: newname}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Mkdir(path string, perm os.FileMode) error {
+	err := fs.fs.Mkdir(path, perm)
+	fs.record(Call{Op: "Mkdir", Path: path, Mode: perm}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	err := fs.fs.MkdirAll(path, perm)
+	fs.record(Call{Op: "MkdirAll", Path: path, Mode: perm}, err)
+	return err
+}
+
+// file wraps a File opened from the underlying FileSystem, numbering it in
+// call, and records the call that opened it.
+func (fs *recordingFilesystem) file(call Call, file File, err error) (File, error) {
+	if err != nil {
+		fs.record(call, err)
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	fs.files++
+	call.File = fs.files
+	fs.calls = append(fs.calls, call)
+	fs.mu.Unlock()
+
+	return &recordingFile{
+		File: file,
+		fs:   fs,
+		id:   call.File,
+	}, nil
+}
+
+func (fs *recordingFilesystem) Open(name string) (File, error) {
+	file, err := fs.fs.Open(name)
+	return fs.file(Call{Op: "Open", Path: name}, file, err)
+}
+
+func (fs *recordingFilesystem) Create(name string) (File, error) {
+	file, err := fs.fs.Create(name)
+	return fs.file(Call{Op: "Create", Path: name}, file, err)
+}
+
+func (fs *recordingFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := fs.fs.OpenFile(name, flag, perm)
+	return fs.file(Call{Op: "OpenFile", Path: name, Flag: flag, Mode: perm}, file, err)
+}
+
+func (fs *recordingFilesystem) Truncate(name string, size int64) error {
+	err := fs.fs.Truncate(name, size)
+	fs.record(Call{Op: "Truncate", Path: name, Size: size}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Remove(name string) error {
+	err := fs.fs.Remove(name)
+	fs.record(Call{Op: "Remove", Path: name}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) RemoveAll(path string) error {
+	err := fs.fs.RemoveAll(path)
+	fs.record(Call{Op: "RemoveAll", Path: path}, err)
+	return err
+}
+
+func (fs *recordingFilesystem) Rename(oldpath, newpath string) error {
+	err := fs.fs.Rename(oldpath, newpath)
+	fs.record(Call{Op: "Rename", Path: oldpath, NewPath: newpath}, err)
+	return err
+}
+
+// recordingFile is a File opened through Record.
+type recordingFile struct {
+	File
+	fs *recordingFilesystem
+	id int
+}
+
+func (f *recordingFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	f.fs.record(Call{Op: "File.Stat", File: f.id, N: size(info)}, err)
+	return info, err
+}
+
+func (f *recordingFile) Chmod(mode os.FileMode) error {
+	err := f.File.Chmod(mode)
+	f.fs.record(Call{Op: "File.Chmod", File: f.id, Mode: mode}, err)
+	return err
+}
+
+func (f *recordingFile) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(n)
+	f.fs.record(Call{Op: "File.Readdir", File: f.id, Len: n, N: int64(len(infos))}, err)
+	return infos, err
+}
+
+func (f *recordingFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.File.Readdirnames(n)
+	f.fs.record(Call{Op: "File.Readdirnames", File: f.id, Len: n, N: int64(len(names))}, err)
+	return names, err
+}
+
+func (f *recordingFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	entries, err := f.File.ReadDir(n)
+	f.fs.record(Call{Op: "File.ReadDir", File: f.id, Len: n, N: int64(len(entries))}, err)
+	return entries, err
+}
+
+func (f *recordingFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.fs.record(Call{Op: "File.Read", File: f.id, Len: len(b), N: int64(n)}, err)
+	return n, err
+}
+
+func (f *recordingFile) ReadAt(b []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(b, off)
+	f.fs.record(Call{Op: "File.ReadAt", File: f.id, Len: len(b), Offset: off, N: int64(n)}, err)
+	return n, err
+}
+
+func (f *recordingFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	f.fs.record(Call{Op: "File.Write", File: f.id, Len: len(b), N: int64(n)}, err)
+	return n, err
+}
+
+func (f *recordingFile) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	f.fs.record(Call{Op: "File.WriteAt", File: f.id, Len: len(b), Offset: off, N: int64(n)}, err)
+	return n, err
+}
+
+func (f *recordingFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	f.fs.record(Call{Op: "File.Seek", File: f.id, Offset: offset, Whence: whence, N: pos}, err)
+	return pos, err
+}
+
+func (f *recordingFile) Truncate(size int64) error {
+	err := f.File.Truncate(size)
+	f.fs.record(Call{Op: "File.Truncate", File: f.id, Size: size}, err)
+	return err
+}
+
+func (f *recordingFile) Sync() error {
+	err := f.File.Sync()
+	f.fs.record(Call{Op: "File.Sync", File: f.id}, err)
+	return err
+}
+
+func (f *recordingFile) Close() error {
+	err := f.File.Close()
+	f.fs.record(Call{Op: "File.Close", File: f.id}, err)
+	return err
+}
+
+// WriteTrace writes calls to w as JSON lines, one call per line.
+func WriteTrace(w io.Writer, calls []Call) error {
+	enc := json.NewEncoder(w)
+	for _, call := range calls {
+		if err := enc.Encode(call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadTrace reads calls written by WriteTrace from r.
+func ReadTrace(r io.Reader) ([]Call, error) {
+	var calls []Call
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var call Call
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+		calls = append(calls, call)
+	}
+	return calls, scanner.Err()
+}
+
+// Divergence is the error Verify returns when a component doesn't make the
+// calls it's expected to.
+type Divergence struct {
+	// Index is the position of the first call that differs.
+	Index int
+
+	// Expected and Actual are the calls at Index, either of which is nil if
+	// that trace ended before the other.
+	Expected *Call
+	Actual   *Call
+}
+
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("call %v: expected %v, got %v", d.Index, d.Expected, d.Actual)
+}
+
+func (c *Call) String() string {
+	if c == nil {
+		return "nothing"
+	}
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+// Verify runs component against fs, recording its calls, and checks that they
+// match trace, which usually comes from an earlier run read back by ReadTrace.
+// It returns a *Divergence describing the first call that differs, if any.
+// Calls are compared as they'd be written by WriteTrace, so errors must have
+// the same message, and fs must be set up the same way it was for the
+// original run.
+func Verify(trace []Call, fs FileSystem, component func(fs FileSystem)) error {
+	recorder := Record(fs)
+	component(recorder)
+	actual := recorder.Trace()
+
+	for i := range max(len(trace), len(actual)) {
+		d := &Divergence{Index: i}
+		if i < len(trace) {
+			d.Expected = &trace[i]
+		}
+		if i < len(actual) {
+			d.Actual = &actual[i]
+		}
+		if d.Expected.String() != d.Actual.String() {
+			return d
+		}
+	}
+	return nil
+}
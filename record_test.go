@@ -0,0 +1,123 @@
+package gofs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// copyConfig is a small component for the tests to record: it copies a config
+// file into a backup directory.
+func copyConfig(fs FileSystem) {
+	data, err := ReadFile(fs, "/etc/config")
+	if err != nil {
+		return
+	}
+	fs.MkdirAll("/backup", os.FileMode(0755))
+	WriteFile(fs, "/backup/config", data, os.FileMode(0644))
+}
+
+func configFs() FileSystem {
+	fs := MockFs()
+	fs.MkdirAll("/etc", os.FileMode(0755))
+	WriteFile(fs, "/etc/config", []byte("Hello World"), os.FileMode(0644))
+	return fs
+}
+
+func TestRecord(t *testing.T) {
+	t.Run("Trace", func(t *testing.T) {
+		fs := Record(configFs())
+		if _, err := fs.Stat("/missing"); err == nil {
+			t.Fatalf("Expected error from Stat")
+		}
+		f, err := fs.Create("/etc/new")
+		if err != nil {
+			t.Fatalf("Unexpected error from Create: %v", err)
+		}
+		f.Write([]byte("Hello"))
+		f.Seek(1, 0)
+		f.Close()
+
+		expected := []Call{
+			{Op: "Stat", Path: "/missing", Err: "stat /missing: no such file or directory"},
+			{Op: "Create", Path: "/etc/new", File: 1},
+			{Op: "File.Write", File: 1, Len: 5, N: 5},
+			{Op: "File.Seek", File: 1, Offset: 1, N: 1},
+			{Op: "File.Close", File: 1},
+		}
+		if trace := fs.Trace(); !reflect.DeepEqual(trace, expected) {
+			t.Fatalf("Unexpected trace: %v", trace)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		fs := Record(configFs())
+		copyConfig(fs)
+		trace := fs.Trace()
+
+		var buf bytes.Buffer
+		if err := WriteTrace(&buf, trace); err != nil {
+			t.Fatalf("Unexpected error from WriteTrace: %v", err)
+		}
+		if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != len(trace) {
+			t.Fatalf("Expected %v lines, got %v", len(trace), lines)
+		}
+		read, err := ReadTrace(&buf)
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadTrace: %v", err)
+		}
+		if !reflect.DeepEqual(read, trace) {
+			t.Fatalf("Expected %v, got %v", trace, read)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	fs := Record(configFs())
+	copyConfig(fs)
+	var golden bytes.Buffer
+	WriteTrace(&golden, fs.Trace())
+
+	t.Run("Match", func(t *testing.T) {
+		trace, err := ReadTrace(bytes.NewReader(golden.Bytes()))
+		if err != nil {
+			t.Fatalf("Unexpected error from ReadTrace: %v", err)
+		}
+		if err := Verify(trace, configFs(), copyConfig); err != nil {
+			t.Fatalf("Unexpected error from Verify: %v", err)
+		}
+	})
+
+	t.Run("Diverge", func(t *testing.T) {
+		trace, _ := ReadTrace(bytes.NewReader(golden.Bytes()))
+		err := Verify(trace, configFs(), func(fs FileSystem) {
+			data, _ := ReadFile(fs, "/etc/config")
+			WriteFile(fs, "/config.bak", data, os.FileMode(0644))
+		})
+		var d *Divergence
+		if !errors.As(err, &d) {
+			t.Fatalf("Expected Divergence, got '%v'", err)
+		}
+		// Reading the file matches; the first call that differs is the one
+		// that would have made the backup directory.
+		if d.Expected == nil || d.Expected.Op != "MkdirAll" || d.Actual == nil || d.Actual.Op != "OpenFile" {
+			t.Fatalf("Unexpected divergence: %v", d)
+		}
+		if d.Index != len(trace)-4 {
+			t.Fatalf("Expected divergence at %v, got %v", len(trace)-4, d.Index)
+		}
+	})
+
+	t.Run("Short", func(t *testing.T) {
+		trace, _ := ReadTrace(bytes.NewReader(golden.Bytes()))
+		err := Verify(trace, configFs(), func(fs FileSystem) {
+			ReadFile(fs, "/etc/config")
+		})
+		var d *Divergence
+		if !errors.As(err, &d) || d.Expected == nil || d.Actual != nil {
+			t.Fatalf("Unexpected divergence: %v", err)
+		}
+	})
+}
@@ -0,0 +1,325 @@
+package gofs
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+)
+
+// Distribution returns how long an operation takes each time it's called. It
+// must be safe to call from several goroutines at once.
+type Distribution func() time.Duration
+
+// Fixed is a Distribution that always returns d.
+func Fixed(d time.Duration) Distribution {
+	return func() time.Duration {
+		return d
+	}
+}
+
+// random returns a Distribution that draws from r, seeded with seed.
+func random(seed uint64, draw func(r *rand.Rand) time.Duration) Distribution {
+	var mu sync.Mutex
+	r := rand.New(rand.NewPCG(seed, 0))
+	return func() time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return draw(r)
+	}
+}
+
+// Uniform is a Distribution spread evenly between lo and hi. The same seed
+// gives the same sequence of durations. It panics if hi is less than lo.
+func Uniform(lo, hi time.Duration, seed uint64) Distribution {
+	if hi < lo {
+		panic(fmt.Sprintf("gofs: Uniform bounds out of order: %v > %v", lo, hi))
+	}
+	return random(seed, func(r *rand.Rand) time.Duration {
+		return lo + time.Duration(r.Int64N(int64(hi-lo)+1))
+	})
+}
+
+// Exponential is a Distribution with the given mean, where most durations are
+// short but a few are much longer. The same seed gives the same sequence of
+// durations.
+func Exponential(mean time.Duration, seed uint64) Distribution {
+	return random(seed, func(r *rand.Rand) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	})
+}
+
+// Latency says how long the operations of a FileSystem wrapped by Slow take.
+type Latency struct {
+	// Ops gives the time taken by each method, named as for Fault.Op.
+	// Methods that aren't listed take Default, or no time at all if that's
+	// nil.
+	Ops     map[string]Distribution
+	Default Distribution
+
+	// BytesPerSecond, if not 0, caps the rate at which data is read and
+	// written, on top of the time each call takes. The cap is shared between
+	// all Files, so concurrent transfers queue up behind each other.
+	BytesPerSecond int64
+}
+
+type slowFilesystem struct {
+	fs      FileSystem
+	clock   Sleeper
+	latency Latency
+
+	// mu guards busy, the time until which transfers already under way keep
+	// the throughput cap busy.
+	mu   sync.Mutex
+	busy time.Time
+}
+
+// Slow wraps fs, and the Files it opens, so that each call sleeps on clock for
+// as long as latency says before going ahead. Reads and writes then sleep for
+// however long it takes to transfer the bytes they moved. With a ManualClock,
+// this all happens in virtual time, so tests don't really wait.
+func Slow(fs FileSystem, clock Sleeper, latency Latency) FileSystem {
+	return &slowFilesystem{
+		fs:      fs,
+		clock:   clock,
+		latency: latency,
+	}
+}
+
+// wait sleeps for as long as op takes.
+func (fs *slowFilesystem) wait(op string) {
+	dist := fs.latency.Ops[op]
+	if dist == nil {
+		dist = fs.latency.Default
+	}
+	if dist == nil {
+		return
+	}
+	if d := dist(); d > 0 {
+		fs.clock.Sleep(d)
+	}
+}
+
+// transfer sleeps until n bytes have made it through the throughput cap.
+func (fs *slowFilesystem) transfer(n int) {
+	if fs.latency.BytesPerSecond <= 0 || n <= 0 {
+		return
+	}
+	d := time.Duration(int64(n) * int64(time.Second) / fs.latency.BytesPerSecond)
+
+	fs.mu.Lock()
+	now := fs.clock.Now()
+	start := fs.busy
+	if start.Before(now) {
+		start = now
+	}
+	fs.busy = start.Add(d)
+	until := fs.busy
+	fs.mu.Unlock()
+
+	// Transfers queued up together finish at their own deadlines, which a
+	// ManualClock can only tell apart from one long sleep after another if
+	// it's told them.
+	if clock, ok := fs.clock.(interface{ SleepUntil(time.Time) }); ok {
+		clock.SleepUntil(until)
+		return
+	}
+	fs.clock.Sleep(until.Sub(now))
+}
+
+func (fs *slowFilesystem) Stat(name string) (os.FileInfo, error) {
+	fs.wait("Stat")
+	return fs.fs.Stat(name)
+}
+
+func (fs *slowFilesystem) Getwd() (string, error) {
+	fs.wait("Getwd")
+	return fs.fs.Getwd()
+}
+
+func (fs *slowFilesystem) Chdir(dir string) error {
+	fs.wait("Chdir")
+	return fs.fs.Chdir(dir)
+}
+
+func (fs *slowFilesystem) Abs(path string) (string, error) {
+	fs.wait("Abs")
+	return fs.fs.Abs(path)
+}
+
+func (fs *slowFilesystem) Chmod(name string, mode os.FileMode) error {
+	fs.wait("Chmod")
+	return fs.fs.Chmod(name, mode)
+}
+
+func (fs *slowFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	fs.wait("Chtimes")
+	return fs.fs.Chtimes(name, atime, mtime)
+}
+
+func (fs *slowFilesystem) Chown(name string, uid, gid int) error {
+	fs.wait("Chown")
+	return fs.fs.Chown(name, uid, gid)
+}
+
+func (fs *slowFilesystem) Lchown(name string, uid, gid int) error {
+	fs.wait("Lchown")
+	return fs.fs.Lchown(name, uid, gid)
+}
+
+func (fs *slowFilesystem) Lstat(name string) (os.FileInfo, error) {
+	fs.wait("Lstat")
+	return fs.fs.Lstat(name)
+}
+
+func (fs *slowFilesystem) Readlink(name string) (string, error) {
+	fs.wait("Readlink")
+	return fs.fs.Readlink(name)
+}
+
+func (fs *slowFilesystem) Symlink(oldname, newname string) error {
+	fs.wait("Symlink")
+	return fs.fs.Symlink(oldname, newname)
+}
+
+func (fs *slowFilesystem) Link(oldname, newname string) error {
+	fs.wait("Link")
+	return fs.fs.Link(oldname, newname)
+}
+
+func (fs *slowFilesystem) Mkdir(path string, perm os.FileMode) error {
+	fs.wait("Mkdir")
+	return fs.fs.Mkdir(path, perm)
+}
+
+func (fs *slowFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	fs.wait("MkdirAll")
+	return fs.fs.MkdirAll(path, perm)
+}
+
+// file wraps a File opened from the underlying FileSystem.
+func (fs *slowFilesystem) file(file File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &slowFile{
+		File: file,
+		fs:   fs,
+	}, nil
+}
+
+func (fs *slowFilesystem) Open(name string) (File, error) {
+	fs.wait("Open")
+	return fs.file(fs.fs.Open(name))
+}
+
+func (fs *slowFilesystem) Create(name string) (File, error) {
+	fs.wait("Create")
+	return fs.file(fs.fs.Create(name))
+}
+
+func (fs *slowFilesystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.wait("OpenFile")
+	return fs.file(fs.fs.OpenFile(name, flag, perm))
+}
+
+func (fs *slowFilesystem) Truncate(name string, size int64) error {
+	fs.wait("Truncate")
+	return fs.fs.Truncate(name, size)
+}
+
+func (fs *slowFilesystem) Remove(name string) error {
+	fs.wait("Remove")
+	return fs.fs.Remove(name)
+}
+
+func (fs *slowFilesystem) RemoveAll(path string) error {
+	fs.wait("RemoveAll")
+	return fs.fs.RemoveAll(path)
+}
+
+func (fs *slowFilesystem) Rename(oldpath, newpath string) error {
+	fs.wait("Rename")
+	return fs.fs.Rename(oldpath, newpath)
+}
+
+// slowFile is a File opened through Slow.
+type slowFile struct {
+	File
+	fs *slowFilesystem
+}
+
+func (f *slowFile) Stat() (os.FileInfo, error) {
+	f.fs.wait("File.Stat")
+	return f.File.Stat()
+}
+
+func (f *slowFile) Chmod(mode os.FileMode) error {
+	f.fs.wait("File.Chmod")
+	return f.File.Chmod(mode)
+}
+
+func (f *slowFile) Readdir(n int) ([]os.FileInfo, error) {
+	f.fs.wait("File.Readdir")
+	return f.File.Readdir(n)
+}
+
+func (f *slowFile) Readdirnames(n int) ([]string, error) {
+	f.fs.wait("File.Readdirnames")
+	return f.File.Readdirnames(n)
+}
+
+func (f *slowFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	f.fs.wait("File.ReadDir")
+	return f.File.ReadDir(n)
+}
+
+func (f *slowFile) Read(b []byte) (int, error) {
+	f.fs.wait("File.Read")
+	n, err := f.File.Read(b)
+	f.fs.transfer(n)
+	return n, err
+}
+
+func (f *slowFile) ReadAt(b []byte, off int64) (int, error) {
+	f.fs.wait("File.ReadAt")
+	n, err := f.File.ReadAt(b, off)
+	f.fs.transfer(n)
+	return n, err
+}
+
+func (f *slowFile) Write(b []byte) (int, error) {
+	f.fs.wait("File.Write")
+	n, err := f.File.Write(b)
+	f.fs.transfer(n)
+	return n, err
+}
+
+func (f *slowFile) WriteAt(b []byte, off int64) (int, error) {
+	f.fs.wait("File.WriteAt")
+	n, err := f.File.WriteAt(b, off)
+	f.fs.transfer(n)
+	return n, err
+}
+
+func (f *slowFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.wait("File.Seek")
+	return f.File.Seek(offset, whence)
+}
+
+func (f *slowFile) Truncate(size int64) error {
+	f.fs.wait("File.Truncate")
+	return f.File.Truncate(size)
+}
+
+func (f *slowFile) Sync() error {
+	f.fs.wait("File.Sync")
+	return f.File.Sync()
+}
+
+func (f *slowFile) Close() error {
+	f.fs.wait("File.Close")
+	return f.File.Close()
+}
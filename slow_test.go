@@ -0,0 +1,148 @@
+package gofs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlow(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	mfs := MockFs(WithClock(clock))
+	fs := Slow(mfs, clock, Latency{
+		Ops: map[string]Distribution{
+			"Stat":       Fixed(10 * time.Millisecond),
+			"File.Write": Fixed(5 * time.Millisecond),
+		},
+		Default:        Fixed(time.Millisecond),
+		BytesPerSecond: 1000,
+	})
+
+	elapsed := func(t *testing.T, expected time.Duration, f func()) {
+		before := clock.Now()
+		f()
+		if d := clock.Now().Sub(before); d != expected {
+			t.Fatalf("Expected %v to pass, got %v", expected, d)
+		}
+	}
+
+	t.Run("Ops", func(t *testing.T) {
+		elapsed(t, 12*time.Millisecond, func() {
+			fs.Mkdir("/dir", os.FileMode(0755))
+			fs.Stat("/dir")
+			fs.Remove("/dir")
+		})
+	})
+
+	t.Run("Throughput", func(t *testing.T) {
+		f, err := fs.Create("/file")
+		if err != nil {
+			t.Fatalf("Unexpected error from Create: %v", err)
+		}
+		defer f.Close()
+
+		elapsed(t, 505*time.Millisecond, func() {
+			f.Write(make([]byte, 500))
+		})
+		// The file's modification time comes from the same virtual clock, and
+		// is before the data took its time to transfer.
+		expected := clock.Now().Add(-500 * time.Millisecond)
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatalf("Unexpected error from Stat: %v", err)
+		}
+		if !info.ModTime().Equal(expected) {
+			t.Fatalf("Expected modification time %v, got %v", expected, info.ModTime())
+		}
+
+		elapsed(t, 201*time.Millisecond, func() {
+			f.ReadAt(make([]byte, 200), 0)
+		})
+	})
+}
+
+// barrierClock is a ManualClock whose sleepers all wait for each other, so that
+// they're sure to be asleep at the same time.
+type barrierClock struct {
+	*ManualClock
+	barrier sync.WaitGroup
+}
+
+func (c *barrierClock) Sleep(d time.Duration) {
+	c.barrier.Done()
+	c.barrier.Wait()
+	c.ManualClock.Sleep(d)
+}
+
+func (c *barrierClock) SleepUntil(t time.Time) {
+	c.barrier.Done()
+	c.barrier.Wait()
+	c.ManualClock.SleepUntil(t)
+}
+
+func TestSlowConcurrent(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &barrierClock{ManualClock: NewManualClock(start)}
+	fs := Slow(MockFs(WithClock(clock)), clock, Latency{BytesPerSecond: 1000})
+
+	var files []File
+	for i := range 4 {
+		f, err := fs.Create(fmt.Sprintf("/file%v", i))
+		if err != nil {
+			t.Fatalf("Unexpected error from Create: %v", err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+
+	// The cap is shared, so the transfers take 400ms between them, even
+	// though they all start at once.
+	clock.barrier.Add(len(files))
+	var wg sync.WaitGroup
+	for _, f := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Write(make([]byte, 100))
+		}()
+	}
+	wg.Wait()
+	if d := clock.Now().Sub(start); d != 400*time.Millisecond {
+		t.Fatalf("Expected 400ms to pass, got %v", d)
+	}
+}
+
+func TestDistributions(t *testing.T) {
+	a := Uniform(time.Millisecond, 2*time.Millisecond, 42)
+	b := Uniform(time.Millisecond, 2*time.Millisecond, 42)
+	for range 100 {
+		d := a()
+		if d < time.Millisecond || d > 2*time.Millisecond {
+			t.Fatalf("Out of range: %v", d)
+		}
+		if other := b(); other != d {
+			t.Fatalf("Same seed gave %v and %v", d, other)
+		}
+	}
+
+	t.Run("BadBounds", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatalf("Expected a panic")
+			}
+		}()
+		Uniform(2*time.Millisecond, time.Millisecond, 42)
+	})
+
+	var total time.Duration
+	exp := Exponential(time.Millisecond, 1)
+	for range 10000 {
+		total += exp()
+	}
+	if mean := total / 10000; mean < 900*time.Microsecond || mean > 1100*time.Microsecond {
+		t.Fatalf("Unexpected mean: %v", mean)
+	}
+}
@@ -0,0 +1,212 @@
+package gofs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// resolver walks paths through a FileSystem made of other FileSystems, which
+// can't simply hand the path down because the symlinks in it have to be
+// followed in the combined view.
+type resolver struct {
+	lstat    func(path string) (os.FileInfo, error)
+	readlink func(path string) (string, error)
+
+	// Whether climbing above the root is an error, like openat2's
+	// RESOLVE_BENEATH, rather than staying put.
+	beneath bool
+}
+
+// resolve turns path, relative to cwd if it isn't absolute, into an absolute
+// path with no symlinks in it. Like the kernel, it always follows symlinks in
+// intermediate components, and only follows the last one if follow is set or
+// the path has a trailing slash. Since the directories it passes through are
+// real, ".." can be resolved lexically as it goes.
+func (r resolver) resolve(cwd string, path string, follow bool) (string, error) {
+	if path == "" {
+		return "", syscall.ENOENT
+	}
+	mustDir := strings.HasSuffix(path, "/")
+	follow = follow || mustDir
+
+	resolved := cwd
+	if strings.HasPrefix(path, "/") {
+		resolved = "/"
+	}
+	components := splitPath(path)
+	hops := 0
+	for len(components) > 0 {
+		name := components[0]
+		components = components[1:]
+		last := len(components) == 0
+
+		if name == ".." && resolved == "/" && r.beneath {
+			return "", syscall.EXDEV
+		}
+		next := filepath.Join(resolved, name)
+		if name == "." || name == ".." || (last && !follow) {
+			resolved = next
+			continue
+		}
+
+		info, err := r.lstat(next)
+		if err != nil {
+			if last && errors.Is(err, os.ErrNotExist) {
+				resolved = next
+				continue
+			}
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			hops++
+			if hops > maxSymlinks {
+				return "", syscall.ELOOP
+			}
+			target, err := r.readlink(next)
+			if err != nil {
+				return "", err
+			}
+			if target == "" {
+				return "", syscall.ENOENT
+			}
+			if strings.HasPrefix(target, "/") {
+				resolved = "/"
+			}
+			components = append(splitPath(target), components...)
+			continue
+		}
+		if !last && !info.IsDir() {
+			return "", syscall.ENOTDIR
+		}
+		resolved = next
+	}
+
+	if mustDir {
+		if info, err := r.lstat(resolved); err == nil && !info.IsDir() {
+			return "", syscall.ENOTDIR
+		}
+	}
+	return resolved, nil
+}
+
+// opError reports err, from resolving a path or from an underlying FileSystem,
+// as an error from op on the path the caller passed in.
+func opError(op string, path string, err error) error {
+	var pe *os.PathError
+	var le *os.LinkError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	} else if errors.As(err, &le) {
+		err = le.Err
+	}
+	return &os.PathError{
+		Op:   op,
+		Err:  err,
+		Path: path,
+	}
+}
+
+// renamedInfo renames a FileInfo from an underlying FileSystem to match the
+// name the caller used.
+type renamedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi *renamedInfo) Name() string {
+	return fi.name
+}
+
+// renamedFile is a File from an underlying FileSystem, which reports the name
+// it was opened with rather than its path in that FileSystem.
+type renamedFile struct {
+	File
+	name string
+}
+
+// fixErr rewrites the path in an error from the underlying File.
+func (f *renamedFile) fixErr(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return &os.PathError{
+			Op:   pe.Op,
+			Err:  pe.Err,
+			Path: f.name,
+		}
+	}
+	return err
+}
+
+func (f *renamedFile) Name() string {
+	return f.name
+}
+
+func (f *renamedFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, f.fixErr(err)
+	}
+	if base := filepath.Base(f.name); info.Name() != base {
+		info = &renamedInfo{info, base}
+	}
+	return info, nil
+}
+
+func (f *renamedFile) Chmod(mode os.FileMode) error {
+	return f.fixErr(f.File.Chmod(mode))
+}
+
+func (f *renamedFile) Readdir(n int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(n)
+	return infos, f.fixErr(err)
+}
+
+func (f *renamedFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.File.Readdirnames(n)
+	return names, f.fixErr(err)
+}
+
+func (f *renamedFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	entries, err := f.File.ReadDir(n)
+	return entries, f.fixErr(err)
+}
+
+func (f *renamedFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	return n, f.fixErr(err)
+}
+
+func (f *renamedFile) ReadAt(b []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(b, off)
+	return n, f.fixErr(err)
+}
+
+func (f *renamedFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	return n, f.fixErr(err)
+}
+
+func (f *renamedFile) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	return n, f.fixErr(err)
+}
+
+func (f *renamedFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	return pos, f.fixErr(err)
+}
+
+func (f *renamedFile) Truncate(size int64) error {
+	return f.fixErr(f.File.Truncate(size))
+}
+
+func (f *renamedFile) Sync() error {
+	return f.fixErr(f.File.Sync())
+}
+
+func (f *renamedFile) Close() error {
+	return f.fixErr(f.File.Close())
+}